@@ -0,0 +1,355 @@
+// Package anki reads and writes Anki .apkg packages: a zip holding the SQLite
+// collection, a JSON index of media files, and the media files themselves
+// stored under numeric names.
+package anki
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ErrUnsupported is returned for packages that only contain the zstd
+// compressed collection written by Anki 2.1.50 and later by default.
+var ErrUnsupported = errors.New("anki: package only has a collection.anki21b; export again with \"Support older Anki versions\" checked")
+
+// ErrTooLarge is returned for package entries that unpack to more than the
+// caller or this package allows.
+var ErrTooLarge = errors.New("anki: file is too large")
+
+// Limits on the unpacked size of package entries, which a zip can claim
+// falsely and compress a thousandfold.
+const (
+	maxCollectionBytes = 1 << 30
+	maxMediaIndexBytes = 16 << 20
+)
+
+// Package is the content of an .apkg file.
+type Package struct {
+	Notes []Note
+
+	zip   *zip.Reader
+	media map[string]string // media file name to zip entry name
+}
+
+// Note is an Anki note with its fields in note type order.
+type Note struct {
+	ID       int64
+	NoteType string
+	Fields   []Field
+	Tags     []string
+	Cards    []Card
+}
+
+type Field struct {
+	Name  string
+	Value string // raw HTML as stored by Anki
+}
+
+// Card is one card generated from a note. Ord is the index of the card's
+// template within the note type, so 0 is usually the front-to-back card.
+type Card struct {
+	ID      int64
+	Ord     int
+	Reviews []Review
+}
+
+// Review is one entry of Anki's review log.
+type Review struct {
+	At     time.Time
+	Ease   int // answer button, 1 (again) to 4 (easy)
+	TimeMs int
+	Type   int // 0 learn, 1 review, 2 relearn, 3 filtered, 4 manual
+
+	// The intervals after and before the answer, only used by WritePackage
+	IntervalDays     float64
+	LastIntervalDays float64
+}
+
+// Manual reports whether the entry records a reschedule rather than an answer.
+func (r Review) Manual() bool { return r.Type == 4 || r.Ease == 0 }
+
+// Read parses an .apkg file.
+func Read(data []byte) (*Package, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("anki: not a zip file: " + err.Error())
+	}
+
+	p := &Package{zip: zr, media: make(map[string]string)}
+	var collection *zip.File
+	hasV3 := false
+	for _, f := range zr.File {
+		switch f.Name {
+		case "collection.anki21":
+			collection = f
+		case "collection.anki2":
+			if collection == nil {
+				collection = f
+			}
+		case "collection.anki21b":
+			hasV3 = true
+		case "media":
+			if err := p.readMediaIndex(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if collection == nil {
+		if hasV3 {
+			return nil, ErrUnsupported
+		}
+		return nil, errors.New("anki: package has no collection")
+	}
+
+	if err := p.readCollection(collection); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Media returns the content of a media file referenced by a note, or
+// ErrTooLarge if it is larger than limit bytes.
+func (p *Package) Media(name string, limit int) ([]byte, error) {
+	entry, ok := p.media[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	f, err := p.zip.Open(entry)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Size() > int64(limit) {
+		return nil, ErrTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(f, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+func (p *Package) readMediaIndex(f *zip.File) error {
+	if f.UncompressedSize64 > maxMediaIndexBytes {
+		return ErrTooLarge
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// Legacy packages index media as {"0": "file.mp3"}; newer ones use a
+	// zstd-compressed protobuf, which is skipped
+	var index map[string]string
+	if json.NewDecoder(io.LimitReader(rc, maxMediaIndexBytes)).Decode(&index) != nil {
+		return nil
+	}
+	for entry, name := range index {
+		p.media[name] = entry
+	}
+	return nil
+}
+
+// readCollection extracts the SQLite collection to a temporary file, since
+// SQLite can only open databases on disk.
+func (p *Package) readCollection(f *zip.File) error {
+	if f.UncompressedSize64 > maxCollectionBytes {
+		return ErrTooLarge
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp("", "anki-*.db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, io.LimitReader(rc, maxCollectionBytes+1))
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if n > maxCollectionBytes {
+		tmp.Close()
+		return ErrTooLarge
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+tmp.Name()+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	noteTypes, err := readNoteTypes(db)
+	if err != nil {
+		return err
+	}
+	if err := p.readNotes(db, noteTypes); err != nil {
+		return err
+	}
+	return p.readCards(db)
+}
+
+type noteType struct {
+	Name   string `json:"name"`
+	Fields []struct {
+		Name string `json:"name"`
+		Ord  int    `json:"ord"`
+	} `json:"flds"`
+}
+
+func readNoteTypes(db *sql.DB) (map[int64]noteType, error) {
+	var models string
+	if err := db.QueryRow("SELECT models FROM col").Scan(&models); err != nil {
+		return nil, errors.New("anki: reading note types: " + err.Error())
+	}
+
+	var byID map[string]noteType
+	if err := json.Unmarshal([]byte(models), &byID); err != nil {
+		return nil, errors.New("anki: reading note types: " + err.Error())
+	}
+	types := make(map[int64]noteType, len(byID))
+	for id, t := range byID {
+		mid, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		sort.Slice(t.Fields, func(i, j int) bool { return t.Fields[i].Ord < t.Fields[j].Ord })
+		types[mid] = t
+	}
+	return types, nil
+}
+
+func (p *Package) readNotes(db *sql.DB, types map[int64]noteType) error {
+	rows, err := db.Query("SELECT id, mid, tags, flds FROM notes ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var note Note
+		var mid int64
+		var tags, fields string
+		if err := rows.Scan(&note.ID, &mid, &tags, &fields); err != nil {
+			return err
+		}
+
+		t := types[mid]
+		note.NoteType = t.Name
+		for i, value := range strings.Split(fields, "\x1f") {
+			name := "Field " + strconv.Itoa(i+1)
+			if i < len(t.Fields) {
+				name = t.Fields[i].Name
+			}
+			note.Fields = append(note.Fields, Field{Name: name, Value: value})
+		}
+		note.Tags = strings.Fields(tags)
+		p.Notes = append(p.Notes, note)
+	}
+	return rows.Err()
+}
+
+func (p *Package) readCards(db *sql.DB) error {
+	notes := make(map[int64]*Note, len(p.Notes))
+	for i := range p.Notes {
+		notes[p.Notes[i].ID] = &p.Notes[i]
+	}
+
+	reviews := make(map[int64][]Review)
+	rows, err := db.Query("SELECT id, cid, ease, time, type FROM revlog ORDER BY id")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id, cardID int64
+		var r Review
+		if err := rows.Scan(&id, &cardID, &r.Ease, &r.TimeMs, &r.Type); err != nil {
+			rows.Close()
+			return err
+		}
+		// Review log IDs are the answer time in milliseconds
+		r.At = time.UnixMilli(id).UTC()
+		reviews[cardID] = append(reviews[cardID], r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Query("SELECT id, nid, ord FROM cards ORDER BY nid, ord")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var card Card
+		var noteID int64
+		if err := rows.Scan(&card.ID, &noteID, &card.Ord); err != nil {
+			return err
+		}
+		card.Reviews = reviews[card.ID]
+		if note, ok := notes[noteID]; ok {
+			note.Cards = append(note.Cards, card)
+		}
+	}
+	return rows.Err()
+}
+
+var (
+	soundRef  = regexp.MustCompile(`\[sound:([^\]]+)\]`)
+	lineBreak = regexp.MustCompile(`(?i)<br\s*/?>|</div>|</p>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// SoundFiles returns the media files referenced by [sound:...] tags in a
+// field.
+func SoundFiles(value string) []string {
+	var files []string
+	for _, m := range soundRef.FindAllStringSubmatch(value, -1) {
+		files = append(files, m[1])
+	}
+	return files
+}
+
+// Text converts a field's HTML to plain text, dropping sound references.
+func Text(value string) string {
+	value = soundRef.ReplaceAllString(value, "")
+	value = lineBreak.ReplaceAllString(value, "\n")
+	value = htmlTag.ReplaceAllString(value, "")
+	value = html.UnescapeString(value)
+	value = strings.ReplaceAll(value, "\u00a0", " ")
+
+	lines := strings.Split(value, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,58 @@
+package anki
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMediaLimit(t *testing.T) {
+	var buf bytes.Buffer
+	note := ExportNote{
+		GUID:      GUID("hola"),
+		Created:   time.Now(),
+		Fields:    []string{"hola", "hello", "", "", "", ""},
+		LoadAudio: func() ([]byte, error) { return bytes.Repeat([]byte{0}, 4096), nil },
+		AudioName: "hola.mp3",
+	}
+	if err := WritePackage(&buf, "Spanish", []ExportNote{note}); err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := Read(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := pkg.Media("hola.mp3", 4096); err != nil || len(data) != 4096 {
+		t.Errorf("Media within the limit = %d bytes, %v", len(data), err)
+	}
+	if _, err := pkg.Media("hola.mp3", 4095); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Media over the limit: err = %v, want ErrTooLarge", err)
+	}
+	if _, err := pkg.Media("adios.mp3", 4096); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Media of a missing file: err = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestReadRejectsOversizedMediaIndex(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Compresses to a few kilobytes
+	if _, err := w.Write(bytes.Repeat([]byte{' '}, maxMediaIndexBytes+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Read(buf.Bytes()); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Read: err = %v, want ErrTooLarge", err)
+	}
+}
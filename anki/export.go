@@ -0,0 +1,361 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportFields are the fields of the note type written by WritePackage.
+var ExportFields = []string{"Content", "Translation", "Meaning", "Pronunciation", "Example", "Notes", "Audio"}
+
+// ExportNote is a note to write, with the scheduling of its cards.
+type ExportNote struct {
+	GUID    string // stable across exports so Anki updates notes on re-import
+	Created time.Time
+	Fields  []string // plain text, one per ExportFields entry except Audio
+	Tags    []string
+
+	// LoadAudio reads the media file referenced from the Audio field.
+	// WritePackage calls it as it writes the file, so only one recording is
+	// held at a time. Nil when the note has no audio.
+	LoadAudio func() ([]byte, error)
+	AudioName string
+
+	Forward ExportCard
+	Reverse *ExportCard // nil when the note has no reverse card
+}
+
+// ExportCard is the scheduling state and review history of a card. A card
+// with a zero Due is new.
+type ExportCard struct {
+	Due          time.Time
+	IntervalDays float64
+	Ease         float64 // SM-2 ease factor, 0 if unknown
+	Reps         int
+	Lapses       int
+	Reviews      []Review
+}
+
+const (
+	exportNoteTypeID = 1342697561419
+	exportDeckID     = 1342697561420
+	defaultFactor    = 2500
+)
+
+const collectionSchema = `
+CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null,
+	ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null,
+	models text not null, decks text not null, dconf text not null, tags text not null);
+CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null,
+	usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null,
+	flags integer not null, data text not null);
+CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null,
+	mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null,
+	ivl integer not null, factor integer not null, reps integer not null, lapses integer not null,
+	left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null);
+CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ease integer not null,
+	ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn ON notes (usn);
+CREATE INDEX ix_cards_usn ON cards (usn);
+CREATE INDEX ix_revlog_usn ON revlog (usn);
+CREATE INDEX ix_cards_nid ON cards (nid);
+CREATE INDEX ix_cards_sched ON cards (did, queue, due);
+CREATE INDEX ix_revlog_cid ON revlog (cid);
+CREATE INDEX ix_notes_csum ON notes (csum);`
+
+// WritePackage writes notes as an .apkg holding a single deck, in the
+// legacy collection format every Anki client, including AnkiDroid, imports.
+func WritePackage(w io.Writer, deckName string, notes []ExportNote) error {
+	tmp, err := os.CreateTemp("", "anki-export-*.db")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	db, err := sql.Open("sqlite3", tmp.Name())
+	if err != nil {
+		return err
+	}
+	media, err := writeCollection(db, deckName, notes)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	collection, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer collection.Close()
+	entry, err := zw.Create("collection.anki2")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(entry, collection); err != nil {
+		return err
+	}
+
+	index := make(map[string]string)
+	for i, note := range media {
+		name := strconv.Itoa(i)
+		index[name] = note.AudioName
+		data, err := note.LoadAudio()
+		if err != nil {
+			return err
+		}
+		entry, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(data); err != nil {
+			return err
+		}
+	}
+	entry, err = zw.Create("media")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(entry).Encode(index); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeCollection fills the collection and returns the notes with audio.
+func writeCollection(db *sql.DB, deckName string, notes []ExportNote) ([]ExportNote, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(collectionSchema); err != nil {
+		return nil, err
+	}
+
+	// Review card due dates count days from the collection's creation, so
+	// it has to predate everything in it
+	now := time.Now().UTC()
+	crt := now
+	earliest := func(t time.Time) {
+		if !t.IsZero() && t.Before(crt) {
+			crt = t
+		}
+	}
+	for _, note := range notes {
+		earliest(note.Created)
+		for _, card := range []*ExportCard{&note.Forward, note.Reverse} {
+			if card == nil {
+				continue
+			}
+			earliest(card.Due)
+			for _, r := range card.Reviews {
+				earliest(r.At)
+			}
+		}
+	}
+	crt = time.Date(crt.Year(), crt.Month(), crt.Day(), 0, 0, 0, 0, time.UTC)
+
+	models, decks, dconf := collectionConfig(deckName, now)
+	_, err = tx.Exec("INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')",
+		crt.Unix(), now.UnixMilli(), now.UnixMilli(), `{"nextPos": `+strconv.Itoa(len(notes)+1)+`}`, models, decks, dconf)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := newIDs()
+	var media []ExportNote
+	for i, note := range notes {
+		fields := make([]string, len(ExportFields))
+		for j := range fields[:len(fields)-1] {
+			if j < len(note.Fields) {
+				fields[j] = fieldHTML(note.Fields[j])
+			}
+		}
+		sortField := ""
+		if len(note.Fields) > 0 {
+			sortField = note.Fields[0]
+		}
+		if note.LoadAudio != nil {
+			fields[len(fields)-1] = "[sound:" + note.AudioName + "]"
+			media = append(media, note)
+		}
+
+		created := note.Created
+		if created.IsZero() {
+			created = now
+		}
+		noteID := ids.next(created)
+		tags := ""
+		if len(note.Tags) > 0 {
+			tags = " " + strings.Join(note.Tags, " ") + " "
+		}
+		_, err := tx.Exec("INSERT INTO notes VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')",
+			noteID, note.GUID, exportNoteTypeID, now.Unix(), tags, strings.Join(fields, "\x1f"),
+			sortField, checksum(sortField))
+		if err != nil {
+			return nil, err
+		}
+
+		cards := []*ExportCard{&note.Forward}
+		if note.Reverse != nil {
+			cards = append(cards, note.Reverse)
+		}
+		for ord, card := range cards {
+			if err := writeCard(tx, ids, noteID, ord, i+1, crt, now, card); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return media, tx.Commit()
+}
+
+func writeCard(tx *sql.Tx, ids *idSource, noteID int64, ord, position int, crt, now time.Time, card *ExportCard) error {
+	cardID := ids.next(time.UnixMilli(noteID))
+	factor := defaultFactor
+	if card.Ease > 0 {
+		factor = int(card.Ease * 1000)
+	}
+
+	// New cards are due by position; review cards by day number
+	cardType, due, ivl := 0, position, 0
+	if !card.Due.IsZero() {
+		cardType = 2
+		due = int(card.Due.Sub(crt).Hours() / 24)
+		ivl = max(int(card.IntervalDays+0.5), 1)
+	}
+	_, err := tx.Exec("INSERT INTO cards VALUES (?, ?, ?, ?, ?, -1, ?, ?, ?, ?, ?, ?, ?, 0, 0, 0, 0, '')",
+		cardID, noteID, exportDeckID, ord, now.Unix(), cardType, cardType, due, ivl, factor, card.Reps, card.Lapses)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range card.Reviews {
+		_, err := tx.Exec("INSERT INTO revlog VALUES (?, ?, -1, ?, ?, ?, ?, ?, ?)",
+			ids.next(r.At), cardID, r.Ease, revlogInterval(r.IntervalDays), revlogInterval(r.LastIntervalDays),
+			factor, r.TimeMs, r.Type)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revlogInterval encodes an interval the way the review log does: whole
+// days when positive, seconds when negative.
+func revlogInterval(days float64) int {
+	if days >= 1 {
+		return int(days + 0.5)
+	}
+	return -int(days * 86400)
+}
+
+// fieldHTML escapes plain text for an Anki field.
+func fieldHTML(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+// checksum is Anki's duplicate check value: the first 8 hex digits of the
+// SHA-1 of the sort field.
+func checksum(s string) int64 {
+	sum := sha1.Sum([]byte(s))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
+
+// GUID derives a stable note GUID from a key.
+func GUID(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// idSource hands out unique millisecond-timestamp IDs, as Anki uses.
+type idSource struct{ used map[int64]bool }
+
+func newIDs() *idSource { return &idSource{used: make(map[int64]bool)} }
+
+func (s *idSource) next(t time.Time) int64 {
+	id := t.UnixMilli()
+	for s.used[id] {
+		id++
+	}
+	s.used[id] = true
+	return id
+}
+
+// collectionConfig returns the col table's note type, deck and deck option
+// JSON for a collection with one deck.
+func collectionConfig(deckName string, now time.Time) (models, decks, dconf string) {
+	type field struct {
+		Name   string        `json:"name"`
+		Ord    int           `json:"ord"`
+		Sticky bool          `json:"sticky"`
+		RTL    bool          `json:"rtl"`
+		Font   string        `json:"font"`
+		Size   int           `json:"size"`
+		Media  []interface{} `json:"media"`
+	}
+	var fields []field
+	for i, name := range ExportFields {
+		fields = append(fields, field{Name: name, Ord: i, Font: "Arial", Size: 20, Media: []interface{}{}})
+	}
+
+	back := `{{FrontSide}}<hr id=answer>`
+	for _, name := range ExportFields[1:6] {
+		back += `{{#` + name + `}}<div>{{` + name + `}}</div>{{/` + name + `}}`
+	}
+	back += `{{Audio}}`
+
+	noteType := map[string]interface{}{
+		"id": exportNoteTypeID, "name": "Language Learner", "type": 0, "mod": now.Unix(), "usn": -1,
+		"sortf": 0, "did": exportDeckID, "flds": fields, "tags": []string{}, "vers": []interface{}{},
+		"tmpls": []map[string]interface{}{
+			{"name": "Forward", "ord": 0, "qfmt": "{{Content}}", "afmt": back, "did": nil, "bqfmt": "", "bafmt": ""},
+			{"name": "Reverse", "ord": 1, "qfmt": "{{Translation}}", "afmt": "{{FrontSide}}<hr id=answer>{{Content}}<div>{{Pronunciation}}</div>{{Audio}}", "did": nil, "bqfmt": "", "bafmt": ""},
+		},
+		"req":       []interface{}{[]interface{}{0, "any", []int{0}}, []interface{}{1, "any", []int{1}}},
+		"css":       ".card { font-family: arial; font-size: 20px; text-align: center; }",
+		"latexPre":  "\\documentclass[12pt]{article}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+	}
+
+	deck := func(id int64, name string) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "name": name, "mod": now.Unix(), "usn": -1, "desc": "", "dyn": 0, "conf": 1,
+			"collapsed": false, "extendNew": 10, "extendRev": 50,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+
+	options := map[string]interface{}{
+		"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true, "timer": 0,
+		"replayq": true, "dyn": false,
+		"new": map[string]interface{}{"delays": []float64{1, 10}, "ints": []int{1, 4, 7}, "initialFactor": defaultFactor,
+			"order": 1, "perDay": 20, "bury": true, "separate": true},
+		"rev": map[string]interface{}{"perDay": 200, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1, "maxIvl": 36500,
+			"bury": true, "minSpace": 1},
+		"lapse": map[string]interface{}{"delays": []float64{10}, "mult": 0, "minInt": 1, "leechFails": 8, "leechAction": 0},
+	}
+
+	m, _ := json.Marshal(map[string]interface{}{strconv.Itoa(exportNoteTypeID): noteType})
+	d, _ := json.Marshal(map[string]interface{}{
+		"1":                        deck(1, "Default"),
+		strconv.Itoa(exportDeckID): deck(exportDeckID, deckName),
+	})
+	c, _ := json.Marshal(map[string]interface{}{"1": options})
+	return string(m), string(d), string(c)
+}
@@ -1,34 +1,45 @@
 package main
 
 import (
-	"language-learner/api"
 	"language-learner/database"
+	"language-learner/router"
 	"log"
 	"net/http"
 	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		os.Exit(runRestore(os.Args[2:]))
+	}
+
 	// Initialize database
 	if err := database.InitDB(); err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 	defer database.CloseDB()
 
+	// Periodic snapshots of the SQLite file, see BACKUP_INTERVAL
+	if !database.Postgres {
+		cfg, err := database.SnapshotConfigFromEnv()
+		if err != nil {
+			log.Fatal("Invalid backup configuration:", err)
+		}
+		if cfg.Interval > 0 {
+			database.StartSnapshots(cfg)
+		}
+	}
+
 	// Get port from environment or default to 8080
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	// Setup routes
-	http.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
-		// Remove /api prefix for handler
-		r.URL.Path = r.URL.Path[4:]
-		api.Handler(w, r)
-	})
-
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Printf("Server starting on port %s, API at %s", port, router.Prefix)
+	log.Fatal(http.ListenAndServe(":"+port, router.New()))
 }
 
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"language-learner/database"
+	"os"
+	"text/tabwriter"
+)
+
+const migrateUsage = `usage: server migrate <command> [-to version]
+
+commands:
+  status  list migrations and whether they have been applied
+  up      apply pending migrations, up to -to if given
+  down    roll back the latest migration, or down to -to if given;
+          0001, the baseline schema, can't be rolled back
+`
+
+// runMigrate implements the migrate subcommand and returns the exit code.
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	command := args[0]
+
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage) }
+	to := flags.Int("to", -1, "target version")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if err := database.Open(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open database:", err)
+		return 1
+	}
+	defer database.CloseDB()
+
+	var err error
+	switch command {
+	case "status":
+		err = printMigrationStatus()
+	case "up":
+		var applied []database.Migration
+		applied, err = database.MigrateUp(max(*to, 0))
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		var rolledBack []database.Migration
+		rolledBack, err = database.MigrateDown(*to)
+		for _, m := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(rolledBack) == 0 {
+			fmt.Println("nothing to roll back")
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	return 0
+}
+
+func printMigrationStatus() error {
+	states, err := database.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS")
+	for _, s := range states {
+		status := "pending"
+		switch {
+		case s.AppliedAt != nil && s.Up == "":
+			status = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05") + " (unknown to this build)"
+		case s.Modified:
+			status = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05") + " (modified since)"
+		case s.AppliedAt != nil:
+			status = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, status)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"language-learner/database"
+	"os"
+)
+
+const restoreUsage = `usage: server restore <snapshot>
+
+Replaces the SQLite database with a snapshot written by POST /api/v1/admin/backup or
+the BACKUP_INTERVAL job. The snapshot must pass PRAGMA integrity_check. Stop
+the server first; the current database is kept next to it.
+`
+
+// runRestore implements the restore subcommand and returns the exit code.
+func runRestore(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, restoreUsage)
+		return 2
+	}
+
+	previous, err := database.Restore(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "restore:", err)
+		return 1
+	}
+	fmt.Println("restored", args[0])
+	if previous != "" {
+		fmt.Println("previous database kept at", previous)
+	}
+	return 0
+}
@@ -2,26 +2,77 @@ package database
 
 import (
 	"database/sql"
+	"errors"
+	"language-learner/store"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
 
+// Store persists users, languages, items and reviews in DB.
+var Store store.Store
+
+// Postgres reports whether DB is a Postgres database rather than SQLite.
+var Postgres bool
+
+// Path is the SQLite database file; empty on Postgres.
+var Path string
+
+// InitDB opens the database and brings its schema up to date.
 func InitDB() error {
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		// For Vercel, use /tmp directory (writable but ephemeral)
-		// For local, use project root
-		if os.Getenv("VERCEL") == "1" {
-			dbPath = "/tmp/language_learner.db"
-		} else {
-			dbPath = "language_learner.db"
+	if err := Open(); err != nil {
+		return err
+	}
+
+	applied, err := MigrateUp(0)
+	if err != nil {
+		return err
+	}
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+
+	// Search needs SQLite's FTS5. The index comes first: a build without
+	// FTS5 must stop before the backfill writes through the index triggers.
+	if !Postgres {
+		if err := initSearch(); err != nil {
+			return err
 		}
 	}
+	if err := backfillNormalizedText(); err != nil {
+		return err
+	}
+
+	log.Println("Database initialized successfully")
+	return nil
+}
+
+// Open connects to the database without touching its schema. DATABASE_URL
+// selects Postgres with a postgres:// URL or SQLite with sqlite:<path>;
+// without it the SQLite database at DB_PATH is used.
+func Open() error {
+	url := os.Getenv("DATABASE_URL")
+	if strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://") {
+		connector, err := pq.NewConnector(url)
+		if err != nil {
+			return err
+		}
+		DB = sql.OpenDB(rebindConnector{connector})
+		Postgres = true
+		Store = store.NewPostgres(DB)
+		return DB.Ping()
+	}
+
+	dbPath, err := sqlitePath()
+	if err != nil {
+		return err
+	}
 
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
@@ -31,25 +82,35 @@ func InitDB() error {
 		}
 	}
 
-	var err error
 	DB, err = sql.Open("sqlite3", dbPath+"?_foreign_keys=1")
 	if err != nil {
 		return err
 	}
+	Path = dbPath
+	Store = store.NewSQLite(DB)
+	return nil
+}
 
-	// Read and execute schema
-	schema, err := os.ReadFile("database/schema.sql")
-	if err != nil {
-		return err
+// sqlitePath returns the SQLite database file selected by DATABASE_URL or
+// DB_PATH.
+func sqlitePath() (string, error) {
+	url := os.Getenv("DATABASE_URL")
+	dbPath := os.Getenv("DB_PATH")
+	if path, ok := strings.CutPrefix(url, "sqlite:"); ok {
+		dbPath = path
+	} else if url != "" {
+		return "", errors.New("DATABASE_URL must start with postgres://, postgresql:// or sqlite:")
 	}
-
-	_, err = DB.Exec(string(schema))
-	if err != nil {
-		return err
+	if dbPath == "" {
+		// For Vercel, use /tmp directory (writable but ephemeral)
+		// For local, use project root
+		if os.Getenv("VERCEL") == "1" {
+			dbPath = "/tmp/language_learner.db"
+		} else {
+			dbPath = "language_learner.db"
+		}
 	}
-
-	log.Println("Database initialized successfully")
-	return nil
+	return dbPath, nil
 }
 
 func CloseDB() error {
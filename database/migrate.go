@@ -0,0 +1,349 @@
+package database
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migrations live in migrations/ as NNNN_name.up.sql with an optional
+// NNNN_name.down.sql, and in migrations/postgres/ for Postgres, numbered
+// the same so both databases share a schema version. 0001 is the schema the
+// app first shipped with; each later change is a migration of its own.
+// Applied migrations are recorded in schema_migrations with a checksum of
+// their up script, so editing one after it shipped is caught instead of
+// silently diverging from databases that already ran it.
+//
+//go:embed migrations/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+const migrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string // empty if the migration can't be rolled back
+	Checksum string
+}
+
+// MigrationState is a migration and whether it has been applied. Modified
+// is set when the applied checksum no longer matches the embedded script.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+	Modified  bool
+}
+
+// Migrations returns the embedded migrations for the database in use, in
+// version order.
+func Migrations() ([]Migration, error) {
+	dir := "migrations"
+	if Postgres {
+		dir = "migrations/postgres"
+	}
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := migrationName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migrations: unexpected file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrations: version %d is used by both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+			sum := sha256.Sum256(data)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migrations: %04d_%s has no up script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrationStatus lists every migration known to this build or recorded in
+// the database. Migrations only the database knows have no Up script.
+func MigrationStatus() ([]MigrationState, error) {
+	if err := prepareMigrations(); err != nil {
+		return nil, err
+	}
+	return migrationStates()
+}
+
+// MigrateUp applies pending migrations up to and including target, or all
+// of them if target is 0, and returns the ones applied.
+func MigrateUp(target int) ([]Migration, error) {
+	if err := prepareMigrations(); err != nil {
+		return nil, err
+	}
+	states, err := checkedMigrationStates()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, s := range states {
+		if s.AppliedAt != nil || (target > 0 && s.Version > target) {
+			continue
+		}
+		if err := runMigration(s.Migration, true); err != nil {
+			return applied, err
+		}
+		applied = append(applied, s.Migration)
+	}
+	return applied, nil
+}
+
+// MigrateDown rolls back applied migrations newer than target, newest
+// first, and returns the ones rolled back. A negative target rolls back
+// only the latest migration. Migrations without a down script, such as the
+// baseline, can't be rolled back.
+func MigrateDown(target int) ([]Migration, error) {
+	if err := prepareMigrations(); err != nil {
+		return nil, err
+	}
+	states, err := checkedMigrationStates()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check every migration can be rolled back before touching any, so
+	// asking for too much changes nothing
+	var pending []Migration
+	for i := len(states) - 1; i >= 0; i-- {
+		s := states[i]
+		if s.AppliedAt == nil || s.Version <= target {
+			continue
+		}
+		if s.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s can't be rolled back", s.Version, s.Name)
+		}
+		pending = append(pending, s.Migration)
+		if target < 0 {
+			break
+		}
+	}
+
+	var rolledBack []Migration
+	for _, m := range pending {
+		if err := runMigration(m, false); err != nil {
+			return rolledBack, err
+		}
+		rolledBack = append(rolledBack, m)
+	}
+	return rolledBack, nil
+}
+
+// prepareMigrations creates schema_migrations and adopts databases whose
+// schema predates it.
+func prepareMigrations() error {
+	var tracked, legacy bool
+	query := `SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE name = 'schema_migrations'),
+		EXISTS(SELECT 1 FROM sqlite_master WHERE name = 'users')`
+	if Postgres {
+		query = `SELECT to_regclass('schema_migrations') IS NOT NULL, to_regclass('users') IS NOT NULL`
+	}
+	if err := DB.QueryRow(query).Scan(&tracked, &legacy); err != nil {
+		return err
+	}
+
+	if tracked {
+		// Builds before the schema was split into steps recorded all of
+		// it as 0001_initial; those databases are adopted like legacy ones
+		var snapshot bool
+		err := DB.QueryRow("SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = 1 AND name = 'initial')").Scan(&snapshot)
+		if err != nil || !snapshot {
+			return err
+		}
+		if _, err := DB.Exec("DELETE FROM schema_migrations"); err != nil {
+			return err
+		}
+		return adoptSchema()
+	}
+
+	if _, err := DB.Exec(migrationsTable); err != nil {
+		return err
+	}
+	if legacy {
+		return adoptSchema()
+	}
+	return nil
+}
+
+// adoptedMigrations identify the migrations whose changes an adopted
+// database may already have, by a table, or a column for migrations that
+// added one, that the migration created. Bootstrapping from schema.sql made
+// the same changes in the same order.
+var adoptedMigrations = []struct {
+	version       int
+	table, column string
+}{
+	{1, "users", ""},
+	{2, "password_reset_tokens", ""},
+	{3, "card_states", ""},
+	{4, "user_settings", ""},
+	{5, "flashcard_sessions", "grade"},
+	{6, "item_revisions", ""},
+	{7, "item_audio", ""},
+	{8, "learning_items", "content_key"},
+	{9, "tags", ""},
+	{10, "decks", ""},
+	{11, "decks", "predicate"},
+	{12, "languages", "script"},
+}
+
+// adoptSchema records as applied the leading migrations whose changes the
+// database already has, so migrating runs only the rest.
+func adoptSchema() error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	byVersion := make(map[int]Migration)
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	query := "SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE ? = '' OR name = ?)"
+	if Postgres {
+		query = `SELECT EXISTS(SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1 AND ($2 = '' OR column_name = $3))`
+	}
+	for _, a := range adoptedMigrations {
+		var present bool
+		if err := DB.QueryRow(query, a.table, a.column, a.column).Scan(&present); err != nil {
+			return err
+		}
+		if !present {
+			break
+		}
+		m := byVersion[a.version]
+		_, err := DB.Exec("INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)",
+			m.Version, m.Name, m.Checksum)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrationStates() ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, len(migrations))
+	index := make(map[int]int)
+	for i, m := range migrations {
+		states[i].Migration = m
+		index[m.Version] = i
+	}
+
+	rows, err := DB.Query("SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var name, checksum string
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &name, &checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		i, ok := index[version]
+		if !ok {
+			states = append(states, MigrationState{Migration: Migration{Version: version, Name: name, Checksum: checksum}})
+			i = len(states) - 1
+		}
+		states[i].AppliedAt = &appliedAt
+		states[i].Modified = ok && states[i].Checksum != checksum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// checkedMigrationStates refuses to migrate a database that ran migrations
+// this build doesn't have, or different versions of the ones it has.
+func checkedMigrationStates() ([]MigrationState, error) {
+	states, err := migrationStates()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range states {
+		if s.AppliedAt != nil && s.Up == "" {
+			return nil, fmt.Errorf("database has migration %04d_%s, which this build doesn't know; run a newer build", s.Version, s.Name)
+		}
+		if s.Modified {
+			return nil, fmt.Errorf("migration %04d_%s was changed after it was applied", s.Version, s.Name)
+		}
+	}
+	return states, nil
+}
+
+// runMigration applies or rolls back m and records it in one transaction.
+func runMigration(m Migration, up bool) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, record := m.Up, "INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)"
+	args := []interface{}{m.Version, m.Name, m.Checksum}
+	if !up {
+		script, record = m.Down, "DELETE FROM schema_migrations WHERE version = ?"
+		args = args[:1]
+	}
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
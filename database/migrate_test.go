@@ -0,0 +1,97 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func openTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "sqlite:"+filepath.Join(t.TempDir(), "test.db"))
+	if err := Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { CloseDB() })
+}
+
+func appliedVersions(t *testing.T) []int {
+	t.Helper()
+	states, err := MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int
+	for _, s := range states {
+		if s.AppliedAt != nil {
+			versions = append(versions, s.Version)
+		}
+	}
+	return versions
+}
+
+func TestMigrateDownKeepsBaseline(t *testing.T) {
+	openTestDB(t)
+	migrations, err := MigrateUp(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	if _, err := MigrateDown(0); err == nil {
+		t.Fatal("MigrateDown(0) rolled back the baseline")
+	}
+	if got := appliedVersions(t); len(got) != len(migrations) {
+		t.Fatalf("after a refused rollback, applied = %v, want all %d", got, len(migrations))
+	}
+
+	rolledBack, err := MigrateDown(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rolledBack) != 1 || rolledBack[0].Version != latest {
+		t.Errorf("MigrateDown(-1) rolled back %v, want only %d", rolledBack, latest)
+	}
+
+	if _, err := MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedVersions(t); len(got) != 1 || got[0] != 1 {
+		t.Errorf("after MigrateDown(1), applied = %v, want [1]", got)
+	}
+	if _, err := MigrateUp(0); err != nil {
+		t.Fatalf("migrating up again: %v", err)
+	}
+}
+
+func TestAdoptLegacySchema(t *testing.T) {
+	openTestDB(t)
+
+	// A database bootstrapped by schema.sql as of the smart decks change
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations[:11] {
+		if _, err := DB.Exec(m.Up); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = DB.Exec(`INSERT INTO users (username, password_hash, forgot_question, forgot_answer_hash) VALUES ('a', 'h', 'q', 'a');
+		INSERT INTO languages (user_id, language_code, language_name) VALUES (1, 'fr', 'French');
+		INSERT INTO learning_items (user_id, language_id, type, content) VALUES (1, 1, 'word', 'Café')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := MigrateUp(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) == 0 || applied[0].Version != 12 {
+		t.Fatalf("MigrateUp applied %v, want 12 onwards", applied)
+	}
+	var content string
+	if err := DB.QueryRow("SELECT content FROM learning_items").Scan(&content); err != nil || content != "Café" {
+		t.Errorf("item after migrating = %q, %v", content, err)
+	}
+}
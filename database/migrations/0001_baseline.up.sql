@@ -1,5 +1,11 @@
+-- The schema the app shipped with, before migrations. It has no down
+-- script: rolling it back would drop every table.
+--
+-- Databases bootstrapped from the old schema.sql are adopted instead of
+-- running this and the migrations after it (see adoptSchema in migrate.go).
+
 -- Users table with authentication
-CREATE TABLE IF NOT EXISTS users (
+CREATE TABLE users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     username TEXT UNIQUE NOT NULL,
     password_hash TEXT NOT NULL,
@@ -9,7 +15,7 @@ CREATE TABLE IF NOT EXISTS users (
 );
 
 -- Languages table
-CREATE TABLE IF NOT EXISTS languages (
+CREATE TABLE languages (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL,
     language_code TEXT NOT NULL,
@@ -20,7 +26,7 @@ CREATE TABLE IF NOT EXISTS languages (
 );
 
 -- Learning items (words, sentences, grammar, etc.)
-CREATE TABLE IF NOT EXISTS learning_items (
+CREATE TABLE learning_items (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL,
     language_id INTEGER NOT NULL,
@@ -38,7 +44,7 @@ CREATE TABLE IF NOT EXISTS learning_items (
 );
 
 -- Flashcard sessions
-CREATE TABLE IF NOT EXISTS flashcard_sessions (
+CREATE TABLE flashcard_sessions (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL,
     language_id INTEGER NOT NULL,
@@ -51,8 +57,7 @@ CREATE TABLE IF NOT EXISTS flashcard_sessions (
 );
 
 -- Create indexes for better performance
-CREATE INDEX IF NOT EXISTS idx_learning_items_user_lang ON learning_items(user_id, language_id);
-CREATE INDEX IF NOT EXISTS idx_learning_items_created ON learning_items(created_at);
-CREATE INDEX IF NOT EXISTS idx_flashcard_sessions_user ON flashcard_sessions(user_id, language_id);
-CREATE INDEX IF NOT EXISTS idx_flashcard_sessions_item ON flashcard_sessions(item_id);
-
+CREATE INDEX idx_learning_items_user_lang ON learning_items(user_id, language_id);
+CREATE INDEX idx_learning_items_created ON learning_items(created_at);
+CREATE INDEX idx_flashcard_sessions_user ON flashcard_sessions(user_id, language_id);
+CREATE INDEX idx_flashcard_sessions_item ON flashcard_sessions(item_id);
@@ -0,0 +1,13 @@
+-- Password reset tokens issued after a correct security answer.
+-- Only an HMAC of the token is stored; each token can be consumed once.
+CREATE TABLE password_reset_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    expires_at DATETIME NOT NULL,
+    consumed_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_password_reset_tokens_user ON password_reset_tokens(user_id);
@@ -0,0 +1,2 @@
+DROP INDEX idx_flashcard_sessions_shown;
+DROP TABLE user_settings;
@@ -0,0 +1,3 @@
+ALTER TABLE flashcard_sessions DROP COLUMN direction;
+ALTER TABLE flashcard_sessions DROP COLUMN response_ms;
+ALTER TABLE flashcard_sessions DROP COLUMN grade;
@@ -0,0 +1,14 @@
+-- Revision history of learning items. changes is a JSON object mapping each
+-- changed column to its old and new value.
+CREATE TABLE item_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    item_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    author_id INTEGER NOT NULL,
+    action TEXT NOT NULL CHECK(action IN ('create', 'update', 'restore')),
+    changes TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (item_id) REFERENCES learning_items(id),
+    FOREIGN KEY (author_id) REFERENCES users(id),
+    UNIQUE(item_id, revision)
+);
@@ -0,0 +1,8 @@
+-- The search index is created outside migrations (see search.go) but
+-- indexes search_text, so it goes with it
+DROP TRIGGER IF EXISTS learning_items_fts_insert;
+DROP TRIGGER IF EXISTS learning_items_fts_delete;
+DROP TRIGGER IF EXISTS learning_items_fts_update;
+DROP TABLE IF EXISTS learning_items_fts;
+ALTER TABLE learning_items DROP COLUMN search_text;
+ALTER TABLE learning_items DROP COLUMN content_key;
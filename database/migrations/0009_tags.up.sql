@@ -0,0 +1,19 @@
+-- User-defined tags and their assignment to learning items
+CREATE TABLE tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL COLLATE NOCASE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE(user_id, name)
+);
+
+CREATE TABLE item_tags (
+    item_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (item_id, tag_id),
+    FOREIGN KEY (item_id) REFERENCES learning_items(id),
+    FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE INDEX idx_item_tags_tag ON item_tags(tag_id);
@@ -0,0 +1,25 @@
+-- Named, ordered collections of items within a language
+CREATE TABLE decks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    language_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (language_id) REFERENCES languages(id),
+    UNIQUE(language_id, name)
+);
+
+CREATE TABLE deck_items (
+    deck_id INTEGER NOT NULL,
+    item_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (deck_id, item_id),
+    FOREIGN KEY (deck_id) REFERENCES decks(id),
+    FOREIGN KEY (item_id) REFERENCES learning_items(id)
+);
+
+CREATE INDEX idx_decks_user ON decks(user_id, language_id);
+CREATE INDEX idx_deck_items_item ON deck_items(item_id);
@@ -0,0 +1 @@
+ALTER TABLE decks DROP COLUMN predicate;
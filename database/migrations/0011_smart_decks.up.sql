@@ -0,0 +1,2 @@
+-- A smart deck's saved JSON predicate; NULL for decks with listed items
+ALTER TABLE decks ADD COLUMN predicate TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE languages DROP COLUMN direction;
+ALTER TABLE languages DROP COLUMN script;
@@ -0,0 +1,3 @@
+-- The ISO 15924 script and writing direction of a language
+ALTER TABLE languages ADD COLUMN script TEXT;
+ALTER TABLE languages ADD COLUMN direction TEXT CHECK(direction IN ('ltr', 'rtl'));
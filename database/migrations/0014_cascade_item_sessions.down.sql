@@ -0,0 +1,26 @@
+CREATE TABLE flashcard_sessions_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    language_id INTEGER NOT NULL,
+    item_id INTEGER NOT NULL,
+    shown_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    was_correct INTEGER NOT NULL CHECK(was_correct IN (0, 1)),
+    grade INTEGER CHECK(grade BETWEEN 1 AND 4),
+    response_ms INTEGER,
+    direction TEXT CHECK(direction IN ('forward', 'reverse')),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (language_id) REFERENCES languages(id),
+    FOREIGN KEY (item_id) REFERENCES learning_items(id)
+);
+
+INSERT INTO flashcard_sessions_old
+    (id, user_id, language_id, item_id, shown_at, was_correct, grade, response_ms, direction)
+SELECT id, user_id, language_id, item_id, shown_at, was_correct, grade, response_ms, direction
+FROM flashcard_sessions;
+
+DROP TABLE flashcard_sessions;
+ALTER TABLE flashcard_sessions_old RENAME TO flashcard_sessions;
+
+CREATE INDEX idx_flashcard_sessions_user ON flashcard_sessions(user_id, language_id);
+CREATE INDEX idx_flashcard_sessions_item ON flashcard_sessions(item_id);
+CREATE INDEX idx_flashcard_sessions_shown ON flashcard_sessions(user_id, shown_at);
@@ -0,0 +1,15 @@
+-- Languages created before the catalog overrode CLDR's low-confidence
+-- script guesses. Codes that name their script, such as sat-Latn, keep it.
+UPDATE languages SET script = 'Grek', direction = 'ltr'
+WHERE (language_code = 'grc' OR language_code LIKE 'grc-%') AND script = 'Cprt'
+    AND language_code NOT LIKE '%-Cprt%';
+UPDATE languages SET script = 'Latn'
+WHERE (language_code = 'non' OR language_code LIKE 'non-%') AND script = 'Runr'
+    AND language_code NOT LIKE '%-Runr%';
+UPDATE languages SET script = 'Latn'
+WHERE (language_code = 'sga' OR language_code LIKE 'sga-%') AND script = 'Ogam'
+    AND language_code NOT LIKE '%-Ogam%';
+UPDATE languages SET script = 'Olck'
+WHERE (language_code = 'sat' OR language_code LIKE 'sat-%') AND script = 'Latn'
+    AND language_code NOT LIKE '%-Latn%';
+UPDATE languages SET script = NULL WHERE script = 'Zzzz';
@@ -0,0 +1,62 @@
+-- The Postgres counterpart of ../0001_baseline.up.sql. Timestamps are UTC
+-- without a time zone, like SQLite's CURRENT_TIMESTAMP, and booleans stay
+-- 0/1 integers so both databases accept the same queries. It has no down
+-- script: rolling it back would drop every table.
+
+-- Users table with authentication
+CREATE TABLE users (
+    id SERIAL PRIMARY KEY,
+    username TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    forgot_question TEXT NOT NULL,
+    forgot_answer_hash TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT (now() AT TIME ZONE 'UTC')
+);
+
+-- Languages table
+CREATE TABLE languages (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    language_code TEXT NOT NULL,
+    language_name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT (now() AT TIME ZONE 'UTC'),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE(user_id, language_code)
+);
+
+-- Learning items (words, sentences, grammar, etc.)
+CREATE TABLE learning_items (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    language_id INTEGER NOT NULL,
+    type TEXT NOT NULL CHECK(type IN ('word', 'sentence', 'grammar', 'letter')),
+    content TEXT NOT NULL,
+    translation TEXT,
+    meaning TEXT,
+    pronunciation TEXT,
+    audio_data TEXT,
+    example_usage TEXT,
+    notes TEXT,
+    created_at TIMESTAMP DEFAULT (now() AT TIME ZONE 'UTC'),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (language_id) REFERENCES languages(id)
+);
+
+-- Flashcard sessions
+CREATE TABLE flashcard_sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    language_id INTEGER NOT NULL,
+    item_id INTEGER NOT NULL,
+    shown_at TIMESTAMP DEFAULT (now() AT TIME ZONE 'UTC'),
+    was_correct INTEGER NOT NULL CHECK(was_correct IN (0, 1)),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (language_id) REFERENCES languages(id),
+    FOREIGN KEY (item_id) REFERENCES learning_items(id)
+);
+
+-- Create indexes for better performance
+CREATE INDEX idx_learning_items_user_lang ON learning_items(user_id, language_id);
+CREATE INDEX idx_learning_items_created ON learning_items(created_at);
+CREATE INDEX idx_flashcard_sessions_user ON flashcard_sessions(user_id, language_id);
+CREATE INDEX idx_flashcard_sessions_item ON flashcard_sessions(item_id);
@@ -0,0 +1,13 @@
+-- Password reset tokens issued after a correct security answer.
+-- Only an HMAC of the token is stored; each token can be consumed once.
+CREATE TABLE password_reset_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT (now() AT TIME ZONE 'UTC'),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_password_reset_tokens_user ON password_reset_tokens(user_id);
@@ -0,0 +1,19 @@
+-- Spaced-repetition state per item, derived from flashcard_sessions
+CREATE TABLE card_states (
+    item_id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    algorithm TEXT NOT NULL,
+    ease DOUBLE PRECISION NOT NULL DEFAULT 0,
+    interval_days DOUBLE PRECISION NOT NULL DEFAULT 0,
+    stability DOUBLE PRECISION NOT NULL DEFAULT 0,
+    difficulty DOUBLE PRECISION NOT NULL DEFAULT 0,
+    reps INTEGER NOT NULL DEFAULT 0,
+    lapses INTEGER NOT NULL DEFAULT 0,
+    last_reviewed_at TIMESTAMP,
+    due_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT (now() AT TIME ZONE 'UTC'),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (item_id) REFERENCES learning_items(id)
+);
+
+CREATE INDEX idx_card_states_due ON card_states(user_id, due_at);
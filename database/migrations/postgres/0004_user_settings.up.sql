@@ -0,0 +1,12 @@
+-- Per-user study preferences
+CREATE TABLE user_settings (
+    user_id INTEGER PRIMARY KEY,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    new_cards_per_day INTEGER NOT NULL DEFAULT 20,
+    reviews_per_day INTEGER NOT NULL DEFAULT 200,
+    updated_at TIMESTAMP DEFAULT (now() AT TIME ZONE 'UTC'),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- The due queue counts each day's reviews
+CREATE INDEX idx_flashcard_sessions_shown ON flashcard_sessions(user_id, shown_at);
@@ -0,0 +1,4 @@
+-- Graded answers, how long they took and which side of the card was shown
+ALTER TABLE flashcard_sessions ADD COLUMN grade INTEGER CHECK(grade BETWEEN 1 AND 4);
+ALTER TABLE flashcard_sessions ADD COLUMN response_ms INTEGER;
+ALTER TABLE flashcard_sessions ADD COLUMN direction TEXT CHECK(direction IN ('forward', 'reverse'));
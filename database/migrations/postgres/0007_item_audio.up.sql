@@ -0,0 +1,11 @@
+-- Pronunciation recordings, one per learning item
+CREATE TABLE item_audio (
+    item_id INTEGER PRIMARY KEY,
+    mime_type TEXT NOT NULL,
+    size_bytes INTEGER NOT NULL,
+    duration_ms INTEGER,
+    sha256 TEXT NOT NULL,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT (now() AT TIME ZONE 'UTC'),
+    FOREIGN KEY (item_id) REFERENCES learning_items(id)
+);
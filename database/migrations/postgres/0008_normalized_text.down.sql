@@ -0,0 +1,2 @@
+ALTER TABLE learning_items DROP COLUMN search_text;
+ALTER TABLE learning_items DROP COLUMN content_key;
@@ -0,0 +1,4 @@
+-- The language-aware normalized forms of an item, for duplicate detection
+-- and search. The app fills them in at startup.
+ALTER TABLE learning_items ADD COLUMN content_key TEXT;
+ALTER TABLE learning_items ADD COLUMN search_text TEXT;
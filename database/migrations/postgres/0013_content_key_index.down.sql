@@ -0,0 +1 @@
+DROP INDEX idx_learning_items_content_key;
@@ -0,0 +1,3 @@
+-- Duplicate checks look items up by content_key. Databases migrated when
+-- the whole schema was one 0001_initial already have the index.
+CREATE INDEX IF NOT EXISTS idx_learning_items_content_key ON learning_items(user_id, language_id, content_key);
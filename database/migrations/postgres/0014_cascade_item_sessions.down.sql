@@ -0,0 +1,4 @@
+ALTER TABLE flashcard_sessions
+    DROP CONSTRAINT flashcard_sessions_item_id_fkey,
+    ADD CONSTRAINT flashcard_sessions_item_id_fkey
+        FOREIGN KEY (item_id) REFERENCES learning_items(id);
@@ -0,0 +1,5 @@
+-- Deleting an item deletes its review sessions
+ALTER TABLE flashcard_sessions
+    DROP CONSTRAINT flashcard_sessions_item_id_fkey,
+    ADD CONSTRAINT flashcard_sessions_item_id_fkey
+        FOREIGN KEY (item_id) REFERENCES learning_items(id) ON DELETE CASCADE;
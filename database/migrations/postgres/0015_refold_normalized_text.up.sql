@@ -0,0 +1,3 @@
+-- Unregistered languages no longer lose their combining marks when
+-- normalized. Clearing the keys makes startup recompute them.
+UPDATE learning_items SET content_key = NULL, search_text = NULL;
@@ -0,0 +1,2 @@
+-- Nothing to undo: the old scripts were wrong.
+SELECT 1;
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"language-learner/store"
+
+	"github.com/lib/pq"
+)
+
+// rebindConnector opens Postgres connections that accept the ? placeholders
+// the rest of the server writes, rewriting them with store.Rebind, so SQL
+// outside the store runs unchanged on both databases.
+type rebindConnector struct {
+	*pq.Connector
+}
+
+func (c rebindConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rebindConn{conn}, nil
+}
+
+// rebindConn wraps a lib/pq connection, which implements every optional
+// driver interface delegated here.
+type rebindConn struct {
+	driver.Conn
+}
+
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(store.Rebind(query))
+}
+
+func (c rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, store.Rebind(query))
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, store.Rebind(query), args)
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, store.Rebind(query), args)
+}
+
+func (c rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c rebindConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c rebindConn) ResetSession(ctx context.Context) error {
+	return c.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c rebindConn) IsValid() bool {
+	return c.Conn.(driver.Validator).IsValid()
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"language-learner/normalize"
+)
+
+// SearchEnabled reports whether the SQLite build includes FTS5 and the
+// learning item search index is available. Build with -tags sqlite_fts5
+// to enable it.
+var SearchEnabled bool
+
+// searchSchema creates an external-content FTS5 index over learning_items
+// and the triggers that keep it in sync. search_text holds the language-aware
+// normalized form of the item, maintained by UpdateNormalizedText.
+const searchSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS learning_items_fts USING fts5(
+    content, translation, meaning, notes, example_usage, search_text,
+    content='learning_items', content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS learning_items_fts_insert AFTER INSERT ON learning_items BEGIN
+    INSERT INTO learning_items_fts (rowid, content, translation, meaning, notes, example_usage, search_text)
+    VALUES (new.id, new.content, new.translation, new.meaning, new.notes, new.example_usage, new.search_text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS learning_items_fts_delete AFTER DELETE ON learning_items BEGIN
+    INSERT INTO learning_items_fts (learning_items_fts, rowid, content, translation, meaning, notes, example_usage, search_text)
+    VALUES ('delete', old.id, old.content, old.translation, old.meaning, old.notes, old.example_usage, old.search_text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS learning_items_fts_update AFTER UPDATE ON learning_items BEGIN
+    INSERT INTO learning_items_fts (learning_items_fts, rowid, content, translation, meaning, notes, example_usage, search_text)
+    VALUES ('delete', old.id, old.content, old.translation, old.meaning, old.notes, old.example_usage, old.search_text);
+    INSERT INTO learning_items_fts (rowid, content, translation, meaning, notes, example_usage, search_text)
+    VALUES (new.id, new.content, new.translation, new.meaning, new.notes, new.example_usage, new.search_text);
+END;
+`
+
+func initSearch() error {
+	var hasFTS5 bool
+	if err := DB.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&hasFTS5); err != nil {
+		return err
+	}
+
+	var exists bool
+	err := DB.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE name = 'learning_items_fts')").Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	// Indexes created before search_text existed are dropped and rebuilt
+	if exists && hasFTS5 {
+		var current bool
+		err := DB.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info('learning_items_fts') WHERE name = 'search_text')").Scan(&current)
+		if err != nil {
+			return err
+		}
+		if !current {
+			if err := dropSearchIndex(); err != nil {
+				return err
+			}
+			exists = false
+		}
+	}
+
+	if !hasFTS5 {
+		if exists {
+			// The sync triggers reference the FTS5 table, so every write to
+			// learning_items would fail
+			return errors.New("the database has a search index but this build lacks FTS5; build with -tags sqlite_fts5")
+		}
+		return nil
+	}
+
+	if _, err := DB.Exec(searchSchema); err != nil {
+		return err
+	}
+
+	// Index items that existed before the search index was created
+	if !exists {
+		if _, err := DB.Exec("INSERT INTO learning_items_fts (learning_items_fts) VALUES ('rebuild')"); err != nil {
+			return err
+		}
+	}
+
+	SearchEnabled = true
+	return nil
+}
+
+func dropSearchIndex() error {
+	for _, stmt := range []string{
+		"DROP TRIGGER IF EXISTS learning_items_fts_insert",
+		"DROP TRIGGER IF EXISTS learning_items_fts_delete",
+		"DROP TRIGGER IF EXISTS learning_items_fts_update",
+		"DROP TABLE IF EXISTS learning_items_fts",
+	} {
+		if _, err := DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx.
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// UpdateNormalizedText recomputes the duplicate-detection key and search
+// text of an item using the normalizer for its language.
+func UpdateNormalizedText(db DBTX, itemID int) error {
+	var code, content string
+	var translation, meaning, pronunciation, notes, exampleUsage sql.NullString
+	err := db.QueryRow(
+		`SELECT l.language_code, li.content, li.translation, li.meaning, li.pronunciation,
+			li.notes, li.example_usage
+		FROM learning_items li JOIN languages l ON l.id = li.language_id
+		WHERE li.id = ?`, itemID,
+	).Scan(&code, &content, &translation, &meaning, &pronunciation, &notes, &exampleUsage)
+	if err != nil {
+		return err
+	}
+
+	searchText := normalize.SearchText(code, content, translation.String, meaning.String,
+		pronunciation.String, notes.String, exampleUsage.String)
+	_, err = db.Exec("UPDATE learning_items SET content_key = ?, search_text = ? WHERE id = ?",
+		normalize.Key(code, content), searchText, itemID)
+	return err
+}
+
+// backfillNormalizedText fills in normalized text for items written before
+// it existed or by clients that don't maintain it.
+func backfillNormalizedText() error {
+	rows, err := DB.Query("SELECT id FROM learning_items WHERE content_key IS NULL")
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := UpdateNormalizedText(DB, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
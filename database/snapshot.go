@@ -0,0 +1,348 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"language-learner/models"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrSnapshotsUnsupported is returned by the snapshot functions on Postgres,
+// which has its own backup tooling.
+var ErrSnapshotsUnsupported = errors.New("snapshots require SQLite")
+
+// The online backup copies snapshotPages pages at a time and pauses between
+// steps so writers aren't locked out for the whole copy. A write in between
+// restarts the copy, which keeps the snapshot consistent.
+const (
+	snapshotPages = 1024
+	snapshotPause = 10 * time.Millisecond
+)
+
+const snapshotLayout = "20060102T150405Z"
+
+// SnapshotConfig controls where snapshots go and how many are kept. Each of
+// the last KeepDaily days and KeepWeekly ISO weeks that have snapshots keeps
+// its newest one.
+type SnapshotConfig struct {
+	Dir        string
+	Interval   time.Duration // 0 disables periodic snapshots
+	KeepDaily  int
+	KeepWeekly int
+}
+
+// SnapshotConfigFromEnv reads BACKUP_DIR (default: backups next to the
+// database), BACKUP_INTERVAL (a duration such as 6h; unset disables periodic
+// snapshots), BACKUP_KEEP_DAILY (default 7) and BACKUP_KEEP_WEEKLY
+// (default 4).
+func SnapshotConfigFromEnv() (SnapshotConfig, error) {
+	cfg := SnapshotConfig{Dir: os.Getenv("BACKUP_DIR"), KeepDaily: 7, KeepWeekly: 4}
+	if cfg.Dir == "" {
+		cfg.Dir = filepath.Join(filepath.Dir(Path), "backups")
+	}
+
+	if v := os.Getenv("BACKUP_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < 0 {
+			return cfg, fmt.Errorf("BACKUP_INTERVAL must be a duration such as 6h, got %q", v)
+		}
+		cfg.Interval = interval
+	}
+	for _, keep := range []struct {
+		env string
+		n   *int
+	}{{"BACKUP_KEEP_DAILY", &cfg.KeepDaily}, {"BACKUP_KEEP_WEEKLY", &cfg.KeepWeekly}} {
+		if v := os.Getenv(keep.env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return cfg, fmt.Errorf("%s must be a non-negative number, got %q", keep.env, v)
+			}
+			*keep.n = n
+		}
+	}
+	if cfg.KeepDaily == 0 && cfg.KeepWeekly == 0 {
+		return cfg, errors.New("BACKUP_KEEP_DAILY and BACKUP_KEEP_WEEKLY can't both be 0")
+	}
+	return cfg, nil
+}
+
+// TakeSnapshot writes a snapshot of the live database to cfg.Dir and then
+// prunes snapshots that fall outside the retention policy.
+func TakeSnapshot(cfg SnapshotConfig) (models.Snapshot, error) {
+	if Postgres {
+		return models.Snapshot{}, ErrSnapshotsUnsupported
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return models.Snapshot{}, err
+	}
+
+	now := time.Now().UTC()
+	snapshot := models.Snapshot{
+		Path:      filepath.Join(cfg.Dir, "snapshot-"+now.Format(snapshotLayout)+".db"),
+		CreatedAt: now,
+	}
+	if err := backupTo(snapshot.Path); err != nil {
+		return snapshot, err
+	}
+	info, err := os.Stat(snapshot.Path)
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.SizeBytes = info.Size()
+
+	snapshot.Pruned, err = pruneSnapshots(cfg)
+	return snapshot, err
+}
+
+// StartSnapshots takes a snapshot every cfg.Interval until the process
+// exits. Failures are logged and retried at the next interval.
+func StartSnapshots(cfg SnapshotConfig) {
+	go func() {
+		for range time.Tick(cfg.Interval) {
+			snapshot, err := TakeSnapshot(cfg)
+			if err != nil {
+				log.Printf("Snapshot failed: %v", err)
+				continue
+			}
+			log.Printf("Wrote snapshot %s (%d bytes)", snapshot.Path, snapshot.SizeBytes)
+		}
+	}()
+}
+
+// backupTo copies the live database to path with SQLite's online backup
+// API. The copy is written next to path and renamed into place when
+// complete, so path never holds a partial snapshot.
+func backupTo(path string) error {
+	tmp := path + ".partial"
+	os.Remove(tmp)
+	defer os.Remove(tmp)
+
+	dest, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	err = destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			backup, err := destDriver.(*sqlite3.SQLiteConn).Backup("main", srcDriver.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := backup.Step(snapshotPages)
+				if err != nil {
+					backup.Close()
+					return err
+				}
+				if done {
+					return backup.Finish()
+				}
+				time.Sleep(snapshotPause)
+			}
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	destConn.Close()
+	if err := dest.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// pruneSnapshots removes the snapshots in cfg.Dir that aren't the newest of
+// one of the last cfg.KeepDaily days or cfg.KeepWeekly weeks, and returns
+// their paths.
+func pruneSnapshots(cfg SnapshotConfig) ([]string, error) {
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type snapshotFile struct {
+		name string
+		at   time.Time
+	}
+	var files []snapshotFile
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), "snapshot-")
+		if !ok || !strings.HasSuffix(stamp, ".db") {
+			continue
+		}
+		at, err := time.Parse(snapshotLayout, strings.TrimSuffix(stamp, ".db"))
+		if err != nil {
+			continue
+		}
+		files = append(files, snapshotFile{entry.Name(), at})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].at.After(files[j].at) })
+
+	days := map[string]bool{}
+	weeks := map[string]bool{}
+	var pruned []string
+	for _, f := range files {
+		day := f.at.Format(time.DateOnly)
+		year, week := f.at.ISOWeek()
+		weekKey := fmt.Sprintf("%d-W%02d", year, week)
+
+		keep := false
+		if !days[day] && len(days) < cfg.KeepDaily {
+			days[day] = true
+			keep = true
+		}
+		if !weeks[weekKey] && len(weeks) < cfg.KeepWeekly {
+			weeks[weekKey] = true
+			keep = true
+		}
+		if keep {
+			continue
+		}
+
+		path := filepath.Join(cfg.Dir, f.name)
+		if err := os.Remove(path); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, path)
+	}
+	return pruned, nil
+}
+
+// CheckIntegrity runs PRAGMA integrity_check on the SQLite file at path. It
+// also rejects files that aren't a database of this app. The file isn't
+// opened read-only because checking an FTS5 index needs write access.
+func CheckIntegrity(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s failed the integrity check: %s", path, strings.Join(problems, "; "))
+	}
+
+	var isApp bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE name = 'users')").Scan(&isApp); err != nil {
+		return err
+	}
+	if !isApp {
+		return fmt.Errorf("%s is not a language learner database", path)
+	}
+	return nil
+}
+
+// Restore replaces the SQLite database with the snapshot at src after
+// checking the snapshot's integrity. The server must not be running. The
+// current database is kept alongside as <name>.before-restore-<time>, whose
+// path is returned; it is empty if there was no database yet.
+func Restore(src string) (string, error) {
+	if strings.HasPrefix(os.Getenv("DATABASE_URL"), "postgres") {
+		return "", ErrSnapshotsUnsupported
+	}
+	dbPath, err := sqlitePath()
+	if err != nil {
+		return "", err
+	}
+	if err := CheckIntegrity(src); err != nil {
+		return "", err
+	}
+
+	// Copy next to the database first so the swap is a rename
+	tmp := dbPath + ".restoring"
+	if err := copyFile(tmp, src); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := CheckIntegrity(tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	var previous string
+	if _, err := os.Stat(dbPath); err == nil {
+		previous = dbPath + ".before-restore-" + time.Now().UTC().Format(snapshotLayout)
+		if err := os.Rename(dbPath, previous); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+		// A journal left by the old database would be applied to the new
+		// one, so it moves with the database it belongs to
+		for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+			if _, err := os.Stat(dbPath + suffix); err == nil {
+				if err := os.Rename(dbPath+suffix, previous+suffix); err != nil {
+					return previous, err
+				}
+			}
+		}
+	}
+	return previous, os.Rename(tmp, dbPath)
+}
+
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,122 @@
+// Package dates keeps timestamps consistent between the app and its database
+// and evaluates the API's date filters in a learner's own calendar.
+//
+// Timestamps are stored in UTC in the format of SQLite's CURRENT_TIMESTAMP,
+// "YYYY-MM-DD HH:MM:SS", so values written by Go and by column defaults
+// compare correctly as text.
+package dates
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Layout is the storage format of timestamps.
+const Layout = time.DateTime
+
+// parseLayouts are tried in order by Parse. Besides Layout they cover the
+// RFC 3339 text database/sql produces when scanning a time.Time into a
+// string, and the forms SQLite's date functions accept.
+var parseLayouts = []string{
+	Layout,
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	time.DateOnly,
+}
+
+// Format returns t in UTC in the storage format.
+func Format(t time.Time) string {
+	return t.UTC().Format(Layout)
+}
+
+// Parse reads a stored timestamp. Timestamps without a zone are UTC.
+func Parse(s string) (time.Time, error) {
+	for _, layout := range parseLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", s)
+}
+
+// StartOfDay returns midnight of t's calendar day in loc.
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+// Range is a span of time from From up to but excluding To. A zero bound
+// leaves that side open.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// ParseRange turns the date_filter, from and to query parameters into a
+// Range of whole calendar days in loc, relative to now:
+//
+//   - day: today
+//   - week: today and the 6 days before
+//   - biweekly: today and the 13 days before
+//   - month: today back to the day after the same date last month
+//   - all or empty: no restriction
+//
+// from and to are dates (YYYY-MM-DD), both inclusive, and either may be left
+// out. They can't be combined with a date_filter other than all.
+func ParseRange(filter, from, to string, now time.Time, loc *time.Location) (Range, error) {
+	var r Range
+	if filter != "" && filter != "all" {
+		if from != "" || to != "" {
+			return r, errors.New("date_filter can't be combined with from or to")
+		}
+
+		today := StartOfDay(now, loc)
+		year, month, day := today.Date()
+		switch filter {
+		case "day":
+			r.From = today
+		case "week":
+			r.From = time.Date(year, month, day-6, 0, 0, 0, 0, loc)
+		case "biweekly":
+			r.From = time.Date(year, month, day-13, 0, 0, 0, 0, loc)
+		case "month":
+			// Clamp to the end of a shorter previous month
+			lastMonth := time.Date(year, month, 0, 0, 0, 0, 0, loc)
+			r.From = time.Date(year, month-1, min(day, lastMonth.Day())+1, 0, 0, 0, 0, loc)
+		default:
+			return r, errors.New("date_filter must be day, week, biweekly, month or all")
+		}
+		return r, nil
+	}
+
+	var err error
+	if from != "" {
+		if r.From, err = parseDay("from", from, loc); err != nil {
+			return r, err
+		}
+	}
+	if to != "" {
+		if r.To, err = parseDay("to", to, loc); err != nil {
+			return r, err
+		}
+		r.To = r.To.AddDate(0, 0, 1)
+	}
+	if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+		return r, errors.New("from must not be after to")
+	}
+	return r, nil
+}
+
+func parseDay(name, value string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation(time.DateOnly, strings.TrimSpace(value), loc)
+	if err != nil {
+		return t, fmt.Errorf("%s must be a date like 2024-01-31", name)
+	}
+	return t, nil
+}
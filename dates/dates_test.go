@@ -0,0 +1,121 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(loc *time.Location, year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, loc)
+	}
+	day := func(loc *time.Location, year int, month time.Month, d int) time.Time {
+		return at(loc, year, month, d, 0)
+	}
+
+	tests := []struct {
+		name             string
+		filter, from, to string
+		now              time.Time
+		loc              *time.Location
+		want             Range
+	}{
+		{"empty", "", "", "", at(time.UTC, 2024, 5, 15, 12), time.UTC, Range{}},
+		{"all", "all", "", "", at(time.UTC, 2024, 5, 15, 12), time.UTC, Range{}},
+		{"day", "day", "", "", at(time.UTC, 2024, 5, 15, 12), time.UTC,
+			Range{From: day(time.UTC, 2024, 5, 15)}},
+		// The day is the learner's, not the server's
+		{"day in loc", "day", "", "", at(time.UTC, 2024, 5, 16, 2), ny,
+			Range{From: day(ny, 2024, 5, 15)}},
+		{"week", "week", "", "", at(time.UTC, 2024, 5, 15, 12), time.UTC,
+			Range{From: day(time.UTC, 2024, 5, 9)}},
+		{"week across a month", "week", "", "", at(time.UTC, 2024, 3, 2, 12), time.UTC,
+			Range{From: day(time.UTC, 2024, 2, 25)}},
+		{"biweekly", "biweekly", "", "", at(time.UTC, 2024, 5, 15, 12), time.UTC,
+			Range{From: day(time.UTC, 2024, 5, 2)}},
+		{"month", "month", "", "", at(time.UTC, 2024, 5, 15, 12), time.UTC,
+			Range{From: day(time.UTC, 2024, 4, 16)}},
+		{"month across a year", "month", "", "", at(time.UTC, 2024, 1, 31, 12), time.UTC,
+			Range{From: day(time.UTC, 2024, 1, 1)}},
+		// Feb 31 doesn't exist, so the month starts after Feb 28
+		{"month from a month end", "month", "", "", at(time.UTC, 2023, 3, 31, 12), time.UTC,
+			Range{From: day(time.UTC, 2023, 3, 1)}},
+		{"month from a leap month end", "month", "", "", at(time.UTC, 2024, 3, 31, 12), time.UTC,
+			Range{From: day(time.UTC, 2024, 3, 1)}},
+		{"month from a short month", "month", "", "", at(time.UTC, 2023, 2, 28, 12), time.UTC,
+			Range{From: day(time.UTC, 2023, 1, 29)}},
+		{"from and to", "", "2024-01-31", "2024-02-29", at(time.UTC, 2024, 5, 15, 12), time.UTC,
+			Range{From: day(time.UTC, 2024, 1, 31), To: day(time.UTC, 2024, 3, 1)}},
+		{"one day", "all", " 2024-02-29 ", "2024-02-29", at(time.UTC, 2024, 5, 15, 12), time.UTC,
+			Range{From: day(time.UTC, 2024, 2, 29), To: day(time.UTC, 2024, 3, 1)}},
+		{"from only", "", "2024-02-01", "", at(time.UTC, 2024, 5, 15, 12), ny,
+			Range{From: day(ny, 2024, 2, 1)}},
+		{"to only", "", "", "2024-12-31", at(time.UTC, 2024, 5, 15, 12), ny,
+			Range{To: day(ny, 2025, 1, 1)}},
+		// Clocks went forward at 2am on 2024-03-10, so that day is 23 hours
+		{"dst day", "day", "", "", at(ny, 2024, 3, 10, 23), ny,
+			Range{From: at(time.UTC, 2024, 3, 10, 5)}},
+		{"dst week", "week", "", "", at(ny, 2024, 3, 12, 9), ny,
+			Range{From: at(time.UTC, 2024, 3, 6, 5)}},
+		{"dst dates", "", "2024-03-10", "2024-03-10", at(time.UTC, 2024, 5, 15, 12), ny,
+			Range{From: at(time.UTC, 2024, 3, 10, 5), To: at(time.UTC, 2024, 3, 11, 4)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRange(tt.filter, tt.from, tt.to, tt.now, tt.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.From.Equal(tt.want.From) || !got.To.Equal(tt.want.To) {
+				t.Errorf("ParseRange = %v - %v, want %v - %v", got.From, got.To, tt.want.From, tt.want.To)
+			}
+		})
+	}
+}
+
+func TestParseRangeErrors(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name, filter, from, to string
+	}{
+		{"unknown filter", "year", "", ""},
+		{"filter with from", "week", "2024-01-01", ""},
+		{"filter with to", "day", "", "2024-01-01"},
+		{"inverted", "", "2024-02-02", "2024-02-01"},
+		{"bad from", "", "2024-13-01", ""},
+		{"bad to", "", "", "2024-02-30"},
+		{"timestamp", "", "2024-02-01T00:00:00Z", ""},
+		{"not a date", "", "yesterday", ""},
+	}
+	for _, tt := range tests {
+		if r, err := ParseRange(tt.filter, tt.from, tt.to, now, time.UTC); err == nil {
+			t.Errorf("%s: ParseRange(%q, %q, %q) = %v, want an error", tt.name, tt.filter, tt.from, tt.to, r)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	want := time.Date(2024, 2, 29, 13, 4, 5, 0, time.UTC)
+	for _, s := range []string{
+		"2024-02-29 13:04:05",
+		"2024-02-29T13:04:05Z",
+		"2024-02-29T14:04:05+01:00",
+		"2024-02-29 08:04:05-05:00",
+		"2024-02-29T13:04:05",
+	} {
+		got, err := Parse(s)
+		if err != nil || !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("Parse(%q) = %v, %v, want %v", s, got, err, want)
+		}
+		if Format(got) != "2024-02-29 13:04:05" {
+			t.Errorf("Format(Parse(%q)) = %q", s, Format(got))
+		}
+	}
+	if _, err := Parse("29/02/2024"); err == nil {
+		t.Error("Parse accepted a day-first date")
+	}
+}
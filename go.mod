@@ -7,3 +7,7 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.18
 	golang.org/x/crypto v0.46.0
 )
+
+require golang.org/x/text v0.32.0
+
+require github.com/lib/pq v1.10.9
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"language-learner/database"
+	"language-learner/store"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// accountDeletes remove everything a user owns, children before parents,
+// since the schema's foreign keys don't cascade. Each takes the user ID.
+var accountDeletes = func() []string {
+	var deletes []string
+	for _, table := range store.ItemDependentTables {
+		deletes = append(deletes, "DELETE FROM "+table+" WHERE item_id IN (SELECT id FROM learning_items WHERE user_id = ?)")
+	}
+	return append(deletes,
+		"DELETE FROM deck_items WHERE deck_id IN (SELECT id FROM decks WHERE user_id = ?)",
+		"DELETE FROM item_tags WHERE tag_id IN (SELECT id FROM tags WHERE user_id = ?)",
+		"DELETE FROM item_revisions WHERE author_id = ?",
+		"DELETE FROM card_states WHERE user_id = ?",
+		"DELETE FROM flashcard_sessions WHERE user_id = ?",
+		"DELETE FROM decks WHERE user_id = ?",
+		"DELETE FROM tags WHERE user_id = ?",
+		"DELETE FROM learning_items WHERE user_id = ?",
+		"DELETE FROM languages WHERE user_id = ?",
+		"DELETE FROM user_settings WHERE user_id = ?",
+		"DELETE FROM password_reset_tokens WHERE user_id = ?",
+		"DELETE FROM users WHERE id = ?",
+	)
+}()
+
+// DeleteAccount permanently removes the caller's account and all of its
+// data in one transaction. The password must be entered again. Tokens
+// already issued stop working because RequireAuth only honors tokens of
+// existing users, and user IDs are never reused.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Password == "" {
+		http.Error(w, "password is required", http.StatusBadRequest)
+		return
+	}
+
+	account, err := database.Store.UserByID(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(req.Password)) != nil {
+		writeError(w, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, query := range accountDeletes {
+		if _, err := tx.Exec(query, userID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userExists reports whether the account behind a token is still there.
+func userExists(userID int) (bool, error) {
+	_, err := database.Store.UserByID(userID)
+	if err == store.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"language-learner/database"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// RequireAdmin lets through only users named in the comma-separated
+// ADMIN_USERS environment variable. It must run after RequireAuth; with
+// ADMIN_USERS unset, nobody is an admin.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requireUser(w, r)
+		if !ok {
+			return
+		}
+
+		account, err := database.Store.UserByID(userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, name := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+			if strings.TrimSpace(name) == account.Username {
+				next(w, r)
+				return
+			}
+		}
+		writeError(w, http.StatusForbidden, "Admin access required")
+	}
+}
+
+// HandleBackup writes a snapshot of the SQLite database with the online
+// backup API, so writes carry on while it runs, and applies the BACKUP_KEEP_*
+// retention policy to older snapshots.
+func HandleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if database.Postgres {
+		writeError(w, http.StatusNotImplemented, "Backups are only supported on SQLite")
+		return
+	}
+
+	cfg, err := database.SnapshotConfigFromEnv()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	snapshot, err := database.TakeSnapshot(cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snapshot)
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"language-learner/anki"
+	"language-learner/database"
+	"language-learner/models"
+	"language-learner/scheduler"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const maxApkgBytes = 100 << 20
+
+// ankiFieldNames are note field names recognized without a mapping. The
+// first unmapped fields become content and translation.
+var ankiFieldNames = map[string]string{
+	"front":         "content",
+	"expression":    "content",
+	"word":          "content",
+	"back":          "translation",
+	"translation":   "translation",
+	"meaning":       "meaning",
+	"definition":    "meaning",
+	"reading":       "pronunciation",
+	"pronunciation": "pronunciation",
+	"example":       "example_usage",
+	"sentence":      "example_usage",
+	"notes":         "notes",
+	"extra":         "notes",
+}
+
+// ankiImport is a note converted to an item, with what to attach to it.
+// The recording is read again from the package when it is saved, so only
+// one is held in memory at a time.
+type ankiImport struct {
+	item      models.LearningItem
+	audio     *models.ItemAudio
+	audioFile string // media name of audio in the package
+	sessions  []models.FlashcardSession
+}
+
+// ImportAnkiPackage creates items from the notes of an Anki .apkg file, sent
+// as the "file" field of a multipart form or as the raw request body. Options
+// come from the query string or form:
+//
+//   - language_id: the language of every imported item (required)
+//   - mapping: a JSON object from note field name to item field (content,
+//     translation, meaning, pronunciation, example_usage, notes or tags); by
+//     default fields are matched by name, then the first two unmatched
+//     fields become content and translation
+//   - type: the type of the imported items, word by default
+//   - include_reviews: true to import Anki's review log as flashcard
+//     sessions, so scheduling continues where Anki left off
+//   - allow_duplicate and dry_run, as for ImportLearningItems
+//
+// Note tags become item tags and the first [sound:...] file in the note
+// becomes the item's audio.
+func ImportAnkiPackage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxApkgBytes+1<<20)
+	data, _, err := readImportFile(r, maxApkgBytes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxApkgBytes {
+		http.Error(w, "package is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	languageID, err := strconv.Atoi(r.FormValue("language_id"))
+	if err != nil {
+		http.Error(w, "language_id parameter required", http.StatusBadRequest)
+		return
+	}
+	if !authorizeLanguage(w, userID, languageID) {
+		return
+	}
+
+	itemType := r.FormValue("type")
+	if itemType == "" {
+		itemType = "word"
+	}
+	if !validItemTypes[itemType] {
+		http.Error(w, "type must be one of word, sentence, grammar, letter", http.StatusBadRequest)
+		return
+	}
+
+	var mapping map[string]string
+	if v := r.FormValue("mapping"); v != "" {
+		if err := json.Unmarshal([]byte(v), &mapping); err != nil {
+			http.Error(w, "mapping must be a JSON object: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, field := range mapping {
+			if _, ok := importFields[field]; !ok || field == "type" {
+				http.Error(w, "mapping: unknown field \""+field+"\"", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	includeReviews := r.FormValue("include_reviews") == "true"
+
+	pkg, err := anki.Read(data)
+	if errors.Is(err, anki.ErrTooLarge) {
+		http.Error(w, "package unpacks to more than the import limit", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batch, err := newImportBatch(r, userID, languageID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	batch.report.Rows = len(pkg.Notes)
+
+	var imports []ankiImport
+	for i, note := range pkg.Notes {
+		row := i + 1
+		imp := ankiImport{item: models.LearningItem{UserID: userID, LanguageID: languageID, Type: itemType}}
+		for field, value := range mapAnkiFields(note, mapping) {
+			importFields[field](&imp.item, value)
+		}
+		for _, tag := range note.Tags {
+			if validateTagName(tag) == nil {
+				imp.item.Tags = append(imp.item.Tags, tag)
+			}
+		}
+
+		if !batch.accept(row, &imp.item) {
+			continue
+		}
+
+		if err := imp.findAudio(pkg, note); err != nil {
+			batch.report.Warnings = append(batch.report.Warnings,
+				models.ImportIssue{Row: row, Field: "audio", Message: err.Error()})
+		}
+		if includeReviews {
+			imp.sessions = ankiSessions(note)
+		}
+		imports = append(imports, imp)
+	}
+
+	batch.report.Imported = len(imports)
+	batch.report.Skipped = batch.report.Rows - batch.report.Imported
+	for _, imp := range imports {
+		if imp.audio != nil {
+			batch.report.Audio++
+		}
+		batch.report.Sessions += len(imp.sessions)
+	}
+
+	if !batch.report.DryRun && len(imports) > 0 {
+		if err := saveAnkiImports(pkg, imports, &batch.report); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch.report)
+}
+
+// mapAnkiFields returns the plain-text value of each item field for a note.
+func mapAnkiFields(note anki.Note, mapping map[string]string) map[string]string {
+	values := make(map[string]string)
+	if mapping != nil {
+		for _, f := range note.Fields {
+			if field, ok := mapping[f.Name]; ok {
+				values[field] = anki.Text(f.Value)
+			}
+		}
+		return values
+	}
+
+	var unmatched []anki.Field
+	for _, f := range note.Fields {
+		field, ok := ankiFieldNames[strings.ToLower(strings.TrimSpace(f.Name))]
+		if _, taken := values[field]; ok && !taken {
+			values[field] = anki.Text(f.Value)
+		} else {
+			unmatched = append(unmatched, f)
+		}
+	}
+	for _, field := range []string{"content", "translation"} {
+		if _, ok := values[field]; !ok && len(unmatched) > 0 {
+			values[field] = anki.Text(unmatched[0].Value)
+			unmatched = unmatched[1:]
+		}
+	}
+	return values
+}
+
+// findAudio attaches the first sound file referenced by the note, checking
+// that it is a supported recording within the size limit.
+func (imp *ankiImport) findAudio(pkg *anki.Package, note anki.Note) error {
+	for _, f := range note.Fields {
+		for _, name := range anki.SoundFiles(f.Value) {
+			data, err := pkg.Media(name, maxAudioBytes)
+			if errors.Is(err, anki.ErrTooLarge) {
+				return errors.New("sound file " + name + " is too large")
+			}
+			if err != nil {
+				return errors.New("sound file " + name + " is missing from the package")
+			}
+			mimeType := audioMimeType(mime.TypeByExtension(filepath.Ext(name)), data)
+			if mimeType == "" {
+				return errors.New("sound file " + name + " is not a supported audio format")
+			}
+			imp.audio = &models.ItemAudio{MimeType: mimeType}
+			imp.audioFile = name
+			return nil
+		}
+	}
+	return nil
+}
+
+// ankiSessions converts the answers in the note's review log to sessions.
+// The note's first card is the forward direction and any others reverse.
+func ankiSessions(note anki.Note) []models.FlashcardSession {
+	var sessions []models.FlashcardSession
+	for _, card := range note.Cards {
+		direction := "forward"
+		if card.Ord > 0 {
+			direction = "reverse"
+		}
+		for _, review := range card.Reviews {
+			if review.Manual() {
+				continue
+			}
+			grade := scheduler.Grade(min(max(review.Ease, 1), 4))
+			responseMs := max(review.TimeMs, 0)
+			sessions = append(sessions, models.FlashcardSession{
+				WasCorrect: grade.Correct(),
+				Grade:      grade,
+				ResponseMs: &responseMs,
+				Direction:  direction,
+				ShownAt:    review.At,
+			})
+		}
+	}
+	return sessions
+}
+
+// saveAnkiImports inserts the items with their audio and sessions in one
+// transaction, then rebuilds card state from the imported history.
+func saveAnkiImports(pkg *anki.Package, imports []ankiImport, report *models.ImportReport) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range imports {
+		imp := &imports[i]
+		if err := insertLearningItem(tx, &imp.item); err != nil {
+			return err
+		}
+		report.ItemIDs = append(report.ItemIDs, imp.item.ID)
+
+		if imp.audio != nil {
+			data, err := pkg.Media(imp.audioFile, maxAudioBytes)
+			if err != nil {
+				return err
+			}
+			imp.audio.ItemID = imp.item.ID
+			if err := database.Store.WithTx(tx).SaveItemAudio(imp.audio, data); err != nil {
+				return err
+			}
+		}
+		for _, s := range imp.sessions {
+			s.UserID, s.LanguageID, s.ItemID = imp.item.UserID, imp.item.LanguageID, imp.item.ID
+			if err := insertSession(tx, s); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, imp := range imports {
+		if len(imp.sessions) == 0 {
+			continue
+		}
+		if _, err := refreshCardState(imp.item.UserID, imp.item.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
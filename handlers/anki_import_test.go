@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bytes"
+	"language-learner/anki"
+	"language-learner/models"
+	"testing"
+	"time"
+)
+
+func TestSaveAnkiImportsReadsAudio(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		f := newReviewFixture(t)
+
+		// Every note shares one recording, which is read once per item as
+		// it is saved
+		audio := bytes.Repeat([]byte{1}, 4096)
+		loadAudio := func() ([]byte, error) { return audio, nil }
+		var notes []anki.ExportNote
+		for _, word := range []string{"uno", "dos", "tres"} {
+			notes = append(notes, anki.ExportNote{GUID: anki.GUID(word), Created: time.Now(),
+				Fields: []string{word, "", "", "", "", ""}, LoadAudio: loadAudio, AudioName: "shared.mp3"})
+		}
+		var buf bytes.Buffer
+		if err := anki.WritePackage(&buf, "Spanish", notes); err != nil {
+			t.Fatal(err)
+		}
+		pkg, err := anki.Read(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var imports []ankiImport
+		for _, note := range pkg.Notes {
+			imp := ankiImport{item: models.LearningItem{UserID: f.userID, LanguageID: f.languageID, Type: "word",
+				Content: mapAnkiFields(note, nil)["content"]}}
+			if err := imp.findAudio(pkg, note); err != nil || imp.audio == nil {
+				t.Fatalf("findAudio = %v, audio %v", err, imp.audio)
+			}
+			imports = append(imports, imp)
+		}
+		var report models.ImportReport
+		if err := saveAnkiImports(pkg, imports, &report); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, id := range report.ItemIDs {
+			saved, data, err := loadItemAudio(id)
+			if err != nil || saved.MimeType != "audio/mpeg" || !bytes.Equal(data, audio) {
+				t.Errorf("item %d audio = %+v, %d bytes, %v", id, saved, len(data), err)
+			}
+		}
+		if len(report.ItemIDs) != 3 {
+			t.Errorf("saved %d items, want 3", len(report.ItemIDs))
+		}
+	})
+}
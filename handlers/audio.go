@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"language-learner/database"
+	"language-learner/models"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxAudioBytes caps the size of a single pronunciation recording.
+const maxAudioBytes = 10 << 20
+
+// UploadItemAudio stores the "audio" file of a multipart form as the item's
+// pronunciation, replacing any previous recording. An optional duration_ms
+// form field records the clip length reported by the client.
+func UploadItemAudio(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeItem(w, userID, id) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAudioBytes+1<<20)
+	file, header, err := r.FormFile("audio")
+	if err != nil {
+		http.Error(w, "audio file is required: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAudioBytes+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "audio file is empty", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxAudioBytes {
+		http.Error(w, "audio file is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	mimeType := audioMimeType(header.Header.Get("Content-Type"), data)
+	if mimeType == "" {
+		http.Error(w, "file is not a supported audio format", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	audio := models.ItemAudio{ItemID: id, MimeType: mimeType}
+	if v := r.FormValue("duration_ms"); v != "" {
+		duration, err := strconv.Atoi(v)
+		if err != nil || duration < 0 {
+			http.Error(w, "duration_ms must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		audio.DurationMs = &duration
+	}
+
+	if err := database.Store.SaveItemAudio(&audio, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(audio)
+}
+
+// GetItemAudio streams the item's recording. Range and conditional requests
+// are handled by http.ServeContent.
+func GetItemAudio(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeItem(w, userID, id) {
+		return
+	}
+
+	audio, data, err := loadItemAudio(id)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Item has no audio")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", audio.MimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+audio.SHA256+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=0, must-revalidate")
+	http.ServeContent(w, r, "", audio.CreatedAt, bytes.NewReader(data))
+}
+
+func DeleteItemAudio(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeItem(w, userID, id) {
+		return
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM item_audio WHERE item_id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := database.DB.Exec("UPDATE learning_items SET audio_data = NULL WHERE id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadItemAudio returns the item's recording, falling back to the base64
+// data URL the TypeScript backend stores in learning_items.audio_data.
+func loadItemAudio(itemID int) (models.ItemAudio, []byte, error) {
+	audio := models.ItemAudio{ItemID: itemID}
+	var data []byte
+	err := database.DB.QueryRow(
+		"SELECT mime_type, size_bytes, duration_ms, sha256, data, created_at FROM item_audio WHERE item_id = ?",
+		itemID,
+	).Scan(&audio.MimeType, &audio.SizeBytes, &audio.DurationMs, &audio.SHA256, &data, &audio.CreatedAt)
+	if err != sql.ErrNoRows {
+		return audio, data, err
+	}
+
+	var dataURL sql.NullString
+	err = database.DB.QueryRow(
+		"SELECT audio_data, created_at FROM learning_items WHERE id = ?", itemID,
+	).Scan(&dataURL, &audio.CreatedAt)
+	if err != nil {
+		return audio, nil, err
+	}
+	if dataURL.String == "" {
+		return audio, nil, sql.ErrNoRows
+	}
+
+	declared, data, err := decodeDataURL(dataURL.String)
+	if err != nil {
+		return audio, nil, err
+	}
+	// The TypeScript backend kept whatever type the client declared
+	if audio.MimeType = audioMimeType(declared, data); audio.MimeType == "" {
+		audio.MimeType = "application/octet-stream"
+	}
+	sum := sha256.Sum256(data)
+	audio.SHA256 = hex.EncodeToString(sum[:])
+	audio.SizeBytes = len(data)
+	return audio, data, nil
+}
+
+// itemAudioType returns the MIME type of an item's recording without reading
+// it, except for recordings the TypeScript backend stored in the item row.
+func itemAudioType(itemID int) (string, error) {
+	var mimeType string
+	err := database.DB.QueryRow("SELECT mime_type FROM item_audio WHERE item_id = ?", itemID).Scan(&mimeType)
+	if err != sql.ErrNoRows {
+		return mimeType, err
+	}
+	audio, _, err := loadItemAudio(itemID)
+	return audio.MimeType, err
+}
+
+// decodeDataURL parses a base64 "data:<mime>;base64,<payload>" URL.
+func decodeDataURL(dataURL string) (string, []byte, error) {
+	meta, payload, ok := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return "", nil, errors.New("audio_data is not a base64 data URL")
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	mimeType, _, _ := strings.Cut(strings.TrimSuffix(meta, ";base64"), ";")
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return mimeType, data, nil
+}
+
+// audioMimeType returns the media type of an uploaded recording, preferring
+// the declared Content-Type and falling back to sniffing the data. Browsers
+// record into WebM and Ogg containers, which sniff as video/webm and
+// application/ogg, so those are accepted as audio too.
+func audioMimeType(declared string, data []byte) string {
+	if mediaType, _, err := mime.ParseMediaType(declared); err == nil && strings.HasPrefix(mediaType, "audio/") {
+		return mediaType
+	}
+
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	switch {
+	case strings.HasPrefix(detected, "audio/"):
+		return detected
+	case detected == "video/webm":
+		return "audio/webm"
+	case detected == "application/ogg":
+		return "audio/ogg"
+	}
+	return ""
+}
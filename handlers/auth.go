@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/json"
 	"language-learner/database"
+	"language-learner/models"
+	"language-learner/store"
 	"net/http"
 	"os"
 	"strings"
@@ -44,7 +46,7 @@ type ForgotPasswordRequest struct {
 }
 
 type ResetPasswordRequest struct {
-	UserId      int    `json:"userId"`
+	ResetToken  string `json:"resetToken"`
 	NewPassword string `json:"newPassword"`
 }
 
@@ -66,13 +68,7 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Find user
-	var userID int
-	var passwordHash string
-	err := database.DB.QueryRow(
-		"SELECT id, password_hash FROM users WHERE username = ?",
-		req.Username,
-	).Scan(&userID, &passwordHash)
-
+	account, err := database.Store.UserByUsername(req.Username)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -81,7 +77,7 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify password
-	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password))
+	err = bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(req.Password))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -91,7 +87,7 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 	// Generate token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId":   userID,
+		"userId":   account.ID,
 		"username": req.Username,
 		"exp":      time.Now().Add(7 * 24 * time.Hour).Unix(),
 	})
@@ -106,7 +102,7 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":  true,
 		"token":   tokenString,
-		"userId":  userID,
+		"userId":  account.ID,
 		"username": req.Username,
 	})
 }
@@ -128,16 +124,6 @@ func HandleSignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if username already exists
-	var existingID int
-	err := database.DB.QueryRow("SELECT id FROM users WHERE username = ?", req.Username).Scan(&existingID)
-	if err == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Username already exists"})
-		return
-	}
-
 	// Hash password and forgot answer
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
 	if err != nil {
@@ -152,21 +138,26 @@ func HandleSignup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert new user
-	result, err := database.DB.Exec(
-		"INSERT INTO users (username, password_hash, forgot_question, forgot_answer_hash) VALUES (?, ?, ?, ?)",
-		req.Username, string(passwordHash), req.ForgotQuestion, string(forgotAnswerHash),
-	)
+	account := store.Account{
+		User:             models.User{Username: req.Username},
+		PasswordHash:     string(passwordHash),
+		ForgotQuestion:   req.ForgotQuestion,
+		ForgotAnswerHash: string(forgotAnswerHash),
+	}
+	err = database.Store.CreateUser(&account)
+	if err == store.ErrConflict {
+		writeError(w, http.StatusBadRequest, "Username already exists")
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	userID, _ := result.LastInsertId()
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
-		"userId":  userID,
+		"userId":  account.ID,
 		"message": "User created successfully",
 	})
 }
@@ -212,6 +203,14 @@ func HandleVerify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Tokens of deleted accounts are no longer valid
+	if exists, err := userExists(int(claims["userId"].(float64))); err != nil || !exists {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]bool{"valid": false})
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"valid":    true,
@@ -238,13 +237,7 @@ func HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Find user
-	var userID int
-	var forgotQuestion, forgotAnswerHash string
-	err := database.DB.QueryRow(
-		"SELECT id, forgot_question, forgot_answer_hash FROM users WHERE username = ?",
-		req.Username,
-	).Scan(&userID, &forgotQuestion, &forgotAnswerHash)
-
+	account, err := database.Store.UserByUsername(req.Username)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
@@ -257,14 +250,14 @@ func HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": true,
-			"userId":  userID,
-			"question": forgotQuestion,
+			"userId":  account.ID,
+			"question": account.ForgotQuestion,
 		})
 		return
 	}
 
 	// Verify forgot answer
-	err = bcrypt.CompareHashAndPassword([]byte(forgotAnswerHash), []byte(strings.ToLower(strings.TrimSpace(req.ForgotAnswer))))
+	err = bcrypt.CompareHashAndPassword([]byte(account.ForgotAnswerHash), []byte(strings.ToLower(strings.TrimSpace(req.ForgotAnswer))))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -272,10 +265,18 @@ func HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Issue a single-use token that HandleResetPassword requires
+	resetToken, expiresAt, err := issueResetToken(account.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"userId":  userID,
+		"success":    true,
+		"resetToken": resetToken,
+		"expiresAt":  expiresAt,
 	})
 }
 
@@ -291,39 +292,55 @@ func HandleResetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.UserId == 0 || req.NewPassword == "" {
-		http.Error(w, "User ID and new password are required", http.StatusBadRequest)
+	if req.ResetToken == "" || req.NewPassword == "" {
+		http.Error(w, "Reset token and new password are required", http.StatusBadRequest)
 		return
 	}
 
-	// Check if user exists
-	var userID int
-	err := database.DB.QueryRow("SELECT id FROM users WHERE id = ?", req.UserId).Scan(&userID)
+	// Hash new password
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 10)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Hash new password
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 10)
+	tx, err := database.DB.Begin()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	// Update password
-	_, err = database.DB.Exec("UPDATE users SET password_hash = ? WHERE id = ?", string(passwordHash), req.UserId)
+	userID, err := consumeResetToken(tx, req.ResetToken)
+	if err == errInvalidResetToken {
+		writeError(w, http.StatusUnauthorized, "Invalid or expired reset token")
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Update password
+	if err := database.Store.WithTx(tx).SetPasswordHash(userID, string(passwordHash)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Any other tokens issued for this user are no longer usable
+	if err := revokeResetTokens(tx, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"message": "Password reset successfully",
 	})
 }
-
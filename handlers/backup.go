@@ -0,0 +1,694 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"language-learner/database"
+	"language-learner/dates"
+	"language-learner/models"
+	"language-learner/normalize"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backups are zip archives of JSON files plus an audio/ directory. The
+// version is bumped whenever a file's layout changes incompatibly, and
+// imports refuse archives newer than they understand.
+const (
+	backupFormat   = "language-learner-backup"
+	backupVersion  = 1
+	maxBackupBytes = 500 << 20
+	// maxBackupFileBytes caps what each JSON file of a backup unpacks to
+	maxBackupFileBytes = 256 << 20
+)
+
+// errBackupFileTooLarge is returned for backup files that unpack to more
+// than the limit.
+var errBackupFileTooLarge = errors.New("backup file unpacks to more than the import limit")
+
+type backupManifest struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Username   string    `json:"username"`
+}
+
+// backupItem is an item with the archive path of its recording.
+type backupItem struct {
+	models.LearningItem
+	Audio *backupAudio `json:"audio,omitempty"`
+}
+
+type backupAudio struct {
+	File       string `json:"file"`
+	MimeType   string `json:"mime_type"`
+	DurationMs *int   `json:"duration_ms,omitempty"`
+}
+
+// backupDeck is a deck with its items in order; smart decks have none.
+type backupDeck struct {
+	models.Deck
+	ItemIDs []int `json:"item_ids,omitempty"`
+}
+
+// backup is the content of an archive. IDs are the exporting account's and
+// are remapped on import.
+type backup struct {
+	Manifest  backupManifest
+	Languages []models.Language
+	Items     []backupItem
+	Sessions  []models.FlashcardSession
+	Decks     []backupDeck
+	Settings  *models.UserSettings
+}
+
+// ExportAccount streams a backup of all of the caller's data: languages,
+// items with their tags and audio, review sessions, decks and settings.
+func ExportAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	b, err := loadBackup(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.zip", b.Manifest.Username, b.Manifest.ExportedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	// The headers are sent once the archive starts, so a later failure can
+	// only cut it short; the zip is then missing its directory and won't open
+	if err := writeBackup(w, b); err != nil {
+		log.Printf("account export for user %d: %v", userID, err)
+	}
+}
+
+func loadBackup(userID int) (*backup, error) {
+	b := &backup{Manifest: backupManifest{Format: backupFormat, Version: backupVersion, ExportedAt: time.Now().UTC()}}
+	if err := database.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&b.Manifest.Username); err != nil {
+		return nil, err
+	}
+
+	languages, err := database.Store.ListLanguages(userID)
+	if err != nil {
+		return nil, err
+	}
+	b.Languages = languages
+
+	var itemIDs []int
+	rows, err := database.DB.Query("SELECT id FROM learning_items WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		itemIDs = append(itemIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range itemIDs {
+		item, err := database.Store.GetItem(id)
+		if err != nil {
+			return nil, err
+		}
+		b.Items = append(b.Items, backupItem{LearningItem: item})
+	}
+
+	sessions, err := loadUserSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range itemIDs {
+		b.Sessions = append(b.Sessions, sessions[id]...)
+	}
+
+	rows, err = database.DB.Query(deckQuery+" WHERE d.user_id = ? ORDER BY d.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		deck, err := scanDeck(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		b.Decks = append(b.Decks, backupDeck{Deck: deck})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range b.Decks {
+		deck := &b.Decks[i]
+		if deck.Predicate != nil {
+			continue
+		}
+		rows, err := database.DB.Query("SELECT item_id FROM deck_items WHERE deck_id = ? ORDER BY position", deck.ID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			deck.ItemIDs = append(deck.ItemIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var saved int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM user_settings WHERE user_id = ?", userID).Scan(&saved); err != nil {
+		return nil, err
+	}
+	if saved > 0 {
+		settings, err := loadUserSettings(userID)
+		if err != nil {
+			return nil, err
+		}
+		b.Settings = &settings
+	}
+	return b, nil
+}
+
+// writeBackup writes the archive, reading each recording as it goes so
+// they are never all in memory at once.
+func writeBackup(w io.Writer, b *backup) error {
+	zw := zip.NewWriter(w)
+	if err := writeZipJSON(zw, "manifest.json", b.Manifest); err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "languages.json", b.Languages); err != nil {
+		return err
+	}
+
+	for i := range b.Items {
+		item := &b.Items[i]
+		if !item.HasAudio {
+			continue
+		}
+		audio, data, err := loadItemAudio(item.ID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		ext, ok := audioExtensions[audio.MimeType]
+		if !ok {
+			ext = ".audio"
+		}
+		item.Audio = &backupAudio{File: "audio/" + strconv.Itoa(item.ID) + ext, MimeType: audio.MimeType, DurationMs: audio.DurationMs}
+
+		// Recordings are already compressed
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: item.Audio.File, Method: zip.Store, Modified: audio.CreatedAt})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := writeZipJSON(zw, "items.json", b.Items); err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "sessions.json", b.Sessions); err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "decks.json", b.Decks); err != nil {
+		return err
+	}
+	if b.Settings != nil {
+		if err := writeZipJSON(zw, "settings.json", b.Settings); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// ImportAccount restores a backup made by ExportAccount into the caller's
+// account, which need not be the one it was exported from. The archive is
+// sent as the "file" field of a multipart form or as the raw body. Options:
+//
+//   - on_conflict: skip (default) or duplicate, for items whose content
+//     matches an existing item in the same language
+//   - dry_run: true to only report what would be restored
+//
+// Languages are merged into existing ones with the same code. Skipped
+// items keep their existing copy, which still joins the restored decks, but
+// their sessions are dropped so importing a backup twice doesn't double the
+// history. Decks whose name is taken and settings, if the account already
+// has some, are skipped. Everything is restored in one transaction.
+func ImportAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBackupBytes+1<<20)
+	data, _, err := readImportFile(r, maxBackupBytes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxBackupBytes {
+		http.Error(w, "backup is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	onConflict := r.FormValue("on_conflict")
+	if onConflict == "" {
+		onConflict = "skip"
+	}
+	if onConflict != "skip" && onConflict != "duplicate" {
+		http.Error(w, "on_conflict must be skip or duplicate", http.StatusBadRequest)
+		return
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		http.Error(w, "not a zip file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, err := readBackup(zr)
+	if errors.Is(err, errBackupFileTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	restore := &backupRestore{
+		userID:     userID,
+		archive:    zr,
+		duplicates: onConflict == "duplicate",
+		report: models.AccountImportReport{
+			DryRun:   r.FormValue("dry_run") == "true",
+			Imported: map[string]int{},
+			Skipped:  map[string]int{},
+			Warnings: []string{},
+		},
+	}
+	if err := restore.run(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(restore.report)
+}
+
+func readBackup(zr *zip.Reader) (*backup, error) {
+	b := &backup{}
+	found, err := readZipJSON(zr, "manifest.json", maxBackupFileBytes, &b.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	if !found || b.Manifest.Format != backupFormat {
+		return nil, errors.New("not a language learner backup")
+	}
+	if b.Manifest.Version > backupVersion {
+		return nil, fmt.Errorf("backup version %d is newer than the supported version %d", b.Manifest.Version, backupVersion)
+	}
+
+	files := map[string]interface{}{
+		"languages.json": &b.Languages,
+		"items.json":     &b.Items,
+		"sessions.json":  &b.Sessions,
+		"decks.json":     &b.Decks,
+		"settings.json":  &b.Settings,
+	}
+	for name, v := range files {
+		if _, err := readZipJSON(zr, name, maxBackupFileBytes, v); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// readZipJSON decodes the named archive file into v, reporting whether it
+// exists. Files that unpack to more than limit bytes are rejected with
+// errBackupFileTooLarge.
+func readZipJSON(zr *zip.Reader, name string, limit int64, v interface{}) (bool, error) {
+	f, err := zr.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Size() > limit {
+		return true, fmt.Errorf("%s: %w", name, errBackupFileTooLarge)
+	}
+
+	// The header's size may not match the content
+	lr := &io.LimitedReader{R: f, N: limit + 1}
+	err = json.NewDecoder(lr).Decode(v)
+	if lr.N == 0 {
+		return true, fmt.Errorf("%s: %w", name, errBackupFileTooLarge)
+	}
+	if err != nil {
+		return true, errors.New(name + ": " + err.Error())
+	}
+	return true, nil
+}
+
+// backupRestore holds the state of one ImportAccount.
+type backupRestore struct {
+	userID     int
+	archive    *zip.Reader
+	duplicates bool
+	report     models.AccountImportReport
+
+	languages map[int]int  // backup language ID to account language ID
+	items     map[int]int  // backup item ID to account item ID, including skipped items' existing copies
+	restored  map[int]int  // backup item ID to the language of its restored copy
+	reviewed  map[int]bool // account item IDs given sessions
+}
+
+func (rs *backupRestore) run(b *backup) error {
+	// Lookups against existing data happen before the transaction, which
+	// holds SQLite's write lock
+	existing, err := rs.existingLanguages()
+	if err != nil {
+		return err
+	}
+	contentKeys := make(map[int]map[string]int)
+	for _, id := range existing {
+		if contentKeys[id], err = existingContentKeys(rs.userID, id); err != nil {
+			return err
+		}
+	}
+	var savedSettings int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM user_settings WHERE user_id = ?", rs.userID).Scan(&savedSettings); err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	codes := make(map[int]string)
+	rs.languages = make(map[int]int)
+	for _, lang := range b.Languages {
+		// Codes from before the catalog are kept if it doesn't know them
+		canonicalizeLanguage(&lang)
+		codes[lang.ID] = lang.LanguageCode
+		if id, ok := existing[strings.ToLower(lang.LanguageCode)]; ok {
+			rs.languages[lang.ID] = id
+			rs.report.Skipped["languages"]++
+			continue
+		}
+		if lang.LanguageCode == "" || lang.LanguageName == "" {
+			rs.warn("language %d has no code or name; skipped with its items", lang.ID)
+			continue
+		}
+		createdAt := lang.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		var id int
+		err := tx.QueryRow(
+			`INSERT INTO languages (user_id, language_code, language_name, script, direction, created_at)
+			VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?) RETURNING id`,
+			rs.userID, lang.LanguageCode, lang.LanguageName, lang.Script, lang.Direction, dates.Format(createdAt)).Scan(&id)
+		if err != nil {
+			return err
+		}
+		rs.languages[lang.ID] = id
+		existing[strings.ToLower(lang.LanguageCode)] = id
+		contentKeys[id] = make(map[string]int)
+		rs.report.Imported["languages"]++
+	}
+
+	rs.items = make(map[int]int)
+	rs.restored = make(map[int]int)
+	rs.reviewed = make(map[int]bool)
+	for _, entry := range b.Items {
+		if err := rs.restoreItem(tx, entry, codes[entry.LanguageID], contentKeys); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range b.Sessions {
+		languageID, ok := rs.restored[s.ItemID]
+		if !ok {
+			rs.report.Skipped["sessions"]++
+			continue
+		}
+		if !s.Grade.Valid() {
+			rs.warn("session of item %d has no valid grade; skipped", s.ItemID)
+			continue
+		}
+		s.UserID, s.LanguageID, s.ItemID = rs.userID, languageID, rs.items[s.ItemID]
+		s.WasCorrect = s.Grade.Correct()
+		if err := insertSession(tx, s); err != nil {
+			return err
+		}
+		rs.reviewed[s.ItemID] = true
+		rs.report.Imported["sessions"]++
+	}
+
+	for _, deck := range b.Decks {
+		if err := rs.restoreDeck(tx, deck); err != nil {
+			return err
+		}
+	}
+
+	if b.Settings != nil {
+		if err := rs.restoreSettings(tx, *b.Settings, savedSettings > 0); err != nil {
+			return err
+		}
+	}
+
+	if rs.report.DryRun {
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for itemID := range rs.reviewed {
+		if _, err := refreshCardState(rs.userID, itemID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rs *backupRestore) existingLanguages() (map[string]int, error) {
+	rows, err := database.DB.Query("SELECT id, language_code FROM languages WHERE user_id = ?", rs.userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	languages := make(map[string]int)
+	for rows.Next() {
+		var id int
+		var code string
+		if err := rows.Scan(&id, &code); err != nil {
+			return nil, err
+		}
+		languages[strings.ToLower(code)] = id
+	}
+	return languages, rows.Err()
+}
+
+func (rs *backupRestore) restoreItem(tx *sql.Tx, entry backupItem, code string, contentKeys map[int]map[string]int) error {
+	languageID, ok := rs.languages[entry.LanguageID]
+	if !ok {
+		rs.report.Skipped["items"]++
+		return nil
+	}
+
+	item := entry.LearningItem
+	oldID := item.ID
+	item.UserID, item.LanguageID = rs.userID, languageID
+	if issue := validateImportItem(&item); issue != nil {
+		rs.warn("item %d: %s: %s; skipped", oldID, issue.Field, issue.Message)
+		rs.report.Skipped["items"]++
+		return nil
+	}
+	if tags, err := cleanTagNames(item.Tags); err != nil {
+		rs.warn("item %d: %v; tags dropped", oldID, err)
+		item.Tags = nil
+	} else {
+		item.Tags = tags
+	}
+
+	key := normalize.Key(code, item.Content)
+	if existingID, ok := contentKeys[languageID][key]; ok && !rs.duplicates {
+		rs.items[oldID] = existingID
+		rs.report.Skipped["items"]++
+		return nil
+	}
+
+	if err := insertLearningItem(tx, &item); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE learning_items SET created_at = COALESCE(?, created_at) WHERE id = ?",
+		formatNullableTime(item.CreatedAt), item.ID); err != nil {
+		return err
+	}
+	contentKeys[languageID][key] = item.ID
+	rs.items[oldID] = item.ID
+	rs.restored[oldID] = languageID
+	rs.report.Imported["items"]++
+
+	if entry.Audio == nil {
+		return nil
+	}
+	data, err := readZipFile(rs.archive, entry.Audio.File)
+	if err != nil {
+		rs.warn("item %d: audio %s: %v; skipped", oldID, entry.Audio.File, err)
+		return nil
+	}
+	audio := &models.ItemAudio{ItemID: item.ID, MimeType: audioMimeType(entry.Audio.MimeType, data), DurationMs: entry.Audio.DurationMs}
+	if audio.MimeType == "" || len(data) > maxAudioBytes {
+		rs.warn("item %d: audio %s is not a supported recording; skipped", oldID, entry.Audio.File)
+		return nil
+	}
+	if err := database.Store.WithTx(tx).SaveItemAudio(audio, data); err != nil {
+		return err
+	}
+	rs.report.Imported["audio"]++
+	return nil
+}
+
+func (rs *backupRestore) restoreDeck(tx *sql.Tx, deck backupDeck) error {
+	languageID, ok := rs.languages[deck.LanguageID]
+	if !ok || deck.Name == "" {
+		rs.report.Skipped["decks"]++
+		return nil
+	}
+
+	var predicate interface{}
+	if deck.Predicate != nil && string(deck.Predicate) != "null" {
+		if _, _, err := parsePredicate(deck.Predicate); err != nil {
+			rs.warn("deck %q: %v; skipped", deck.Name, err)
+			rs.report.Skipped["decks"]++
+			return nil
+		}
+		predicate = string(deck.Predicate)
+	}
+
+	var deckID int
+	err := tx.QueryRow(
+		"INSERT INTO decks (user_id, language_id, name, description, predicate) VALUES (?, ?, ?, ?, ?) ON CONFLICT(language_id, name) DO NOTHING RETURNING id",
+		rs.userID, languageID, deck.Name, deck.Description, predicate).Scan(&deckID)
+	if err == sql.ErrNoRows {
+		rs.warn("deck %q already exists; skipped", deck.Name)
+		rs.report.Skipped["decks"]++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rs.report.Imported["decks"]++
+
+	position := 0
+	for _, oldID := range deck.ItemIDs {
+		itemID, ok := rs.items[oldID]
+		if !ok {
+			continue
+		}
+		// Items moved to another language since the backup can't join
+		result, err := tx.Exec(
+			`INSERT INTO deck_items (deck_id, item_id, position)
+			SELECT CAST(? AS INTEGER), id, CAST(? AS INTEGER) FROM learning_items WHERE id = ? AND language_id = ?
+			ON CONFLICT DO NOTHING`,
+			deckID, position+1, itemID, languageID)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			position++
+		}
+	}
+	return nil
+}
+
+func (rs *backupRestore) restoreSettings(tx *sql.Tx, settings models.UserSettings, saved bool) error {
+	if saved {
+		rs.warn("settings already saved; skipped")
+		rs.report.Skipped["settings"]++
+		return nil
+	}
+	if _, err := time.LoadLocation(settings.Timezone); err != nil || settings.Timezone == "" ||
+		settings.NewCardsPerDay < 0 || settings.ReviewsPerDay < 0 {
+		rs.warn("settings are invalid; skipped")
+		rs.report.Skipped["settings"]++
+		return nil
+	}
+	_, err := tx.Exec(
+		"INSERT INTO user_settings (user_id, timezone, new_cards_per_day, reviews_per_day) VALUES (?, ?, ?, ?)",
+		rs.userID, settings.Timezone, settings.NewCardsPerDay, settings.ReviewsPerDay)
+	if err == nil {
+		rs.report.Imported["settings"]++
+	}
+	return err
+}
+
+func (rs *backupRestore) warn(format string, args ...interface{}) {
+	rs.report.Warnings = append(rs.report.Warnings, fmt.Sprintf(format, args...))
+}
+
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, maxAudioBytes+1))
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadZipJSONLimit(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"settings.json": `{"timezone": "UTC"}`,
+		// Compresses to a few bytes
+		"items.json": "[" + strings.Repeat(" ", 4096) + "]",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var settings struct{ Timezone string }
+	if found, err := readZipJSON(zr, "settings.json", 1024, &settings); !found || err != nil || settings.Timezone != "UTC" {
+		t.Errorf("readZipJSON(settings.json) = %v, %v, %+v", found, err, settings)
+	}
+	var items []backupItem
+	if _, err := readZipJSON(zr, "items.json", 1024, &items); !errors.Is(err, errBackupFileTooLarge) {
+		t.Errorf("readZipJSON(items.json): err = %v, want errBackupFileTooLarge", err)
+	}
+	if found, err := readZipJSON(zr, "decks.json", 1024, &items); found || err != nil {
+		t.Errorf("readZipJSON of a missing file = %v, %v", found, err)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"language-learner/database"
+	"language-learner/dates"
+	"language-learner/scheduler"
+	"log"
+	"os"
+	"time"
+)
+
+// cardScheduler is selected with the SCHEDULER environment variable
+// ("sm2" or "fsrs").
+var cardScheduler = loadScheduler()
+
+func loadScheduler() scheduler.Scheduler {
+	s, err := scheduler.New(os.Getenv("SCHEDULER"))
+	if err != nil {
+		log.Printf("%v, falling back to %s", err, scheduler.Default)
+		s, _ = scheduler.New(scheduler.Default)
+	}
+	return s
+}
+
+// refreshCardState replays the item's review history through cardScheduler
+// and stores the resulting state in card_states.
+func refreshCardState(userID, itemID int) (scheduler.CardState, error) {
+	sessions, err := database.Store.ListSessions(userID, itemID)
+	if err != nil {
+		return scheduler.CardState{}, err
+	}
+
+	var reviews []scheduler.Review
+	for _, s := range sessions {
+		// Sessions recorded before grades existed only have pass/fail
+		review := scheduler.Review{At: s.ShownAt, Grade: s.Grade}
+		if review.Grade == 0 {
+			review.Grade = scheduler.GradeFromCorrect(s.WasCorrect)
+		}
+		reviews = append(reviews, review)
+	}
+
+	state := scheduler.Replay(cardScheduler, reviews)
+	return state, database.Store.SaveCardState(userID, itemID, cardScheduler.Name(), state)
+}
+
+// formatNullableTime formats t for storage, see dates.Format, and maps the
+// zero time to NULL.
+func formatNullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return dates.Format(t)
+}
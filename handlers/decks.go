@@ -0,0 +1,724 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"language-learner/database"
+	"language-learner/models"
+	"language-learner/store"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const deckQuery = `SELECT d.id, d.user_id, d.language_id, d.name, COALESCE(d.description, ''), d.predicate, d.created_at,
+	(SELECT COUNT(*) FROM deck_items di WHERE di.deck_id = d.id)
+	FROM decks d`
+
+// DeckUpdate holds the fields of a PUT/PATCH request. Nil fields are left
+// unchanged. Predicate can only be changed on smart decks.
+type DeckUpdate struct {
+	Name        *string          `json:"name"`
+	Description *string          `json:"description"`
+	Predicate   *json.RawMessage `json:"predicate"`
+}
+
+// DeckItemsRequest lists items to add to a deck, or the full new order of a
+// deck's items. Position, when adding, is where the first item is inserted,
+// counting from 1; items are appended by default.
+type DeckItemsRequest struct {
+	ItemIDs  []int `json:"item_ids"`
+	Position int   `json:"position"`
+}
+
+func scanDeck(row interface{ Scan(...interface{}) error }) (models.Deck, error) {
+	var deck models.Deck
+	var predicate sql.NullString
+	err := row.Scan(&deck.ID, &deck.UserID, &deck.LanguageID, &deck.Name, &deck.Description,
+		&predicate, &deck.CreatedAt, &deck.ItemCount)
+	if predicate.Valid {
+		deck.Predicate = json.RawMessage(predicate.String)
+	}
+	return deck, err
+}
+
+func loadDeck(q querier, id int) (models.Deck, error) {
+	deck, err := scanDeck(q.QueryRow(deckQuery+" WHERE d.id = ?", id))
+	if err != nil {
+		return deck, err
+	}
+	return deck, countSmartDeck(q, &deck)
+}
+
+// countSmartDeck sets the item count of a smart deck, which has no
+// deck_items rows, to the number of items its predicate matches now.
+func countSmartDeck(q querier, deck *models.Deck) error {
+	if deck.Predicate == nil {
+		return nil
+	}
+	items, args, err := smartDeckItems(deck.UserID, deck.LanguageID, deck.Predicate)
+	if err != nil {
+		return err
+	}
+	return q.QueryRow("SELECT COUNT(*) FROM ("+items+") matches", args...).Scan(&deck.ItemCount)
+}
+
+// rejectSmartDeck refuses to edit the items of a smart deck by hand.
+func rejectSmartDeck(w http.ResponseWriter, deck models.Deck) bool {
+	if deck.Predicate != nil {
+		writeError(w, http.StatusConflict, "Smart deck items are chosen by its predicate")
+		return true
+	}
+	return false
+}
+
+func GetDecks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := deckQuery + " WHERE d.user_id = ?"
+	args := []interface{}{userID}
+	if languageID := r.URL.Query().Get("language_id"); languageID != "" {
+		query += " AND d.language_id = ?"
+		args = append(args, languageID)
+	}
+	query += " ORDER BY d.name"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	decks := []models.Deck{}
+	for rows.Next() {
+		deck, err := scanDeck(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		decks = append(decks, deck)
+	}
+	rows.Close()
+
+	for i := range decks {
+		if err := countSmartDeck(database.DB, &decks[i]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decks)
+}
+
+func CreateDeck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var deck models.Deck
+	if err := json.NewDecoder(r.Body).Decode(&deck); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkBodyUser(w, deck.UserID, userID) || !authorizeLanguage(w, userID, deck.LanguageID) {
+		return
+	}
+	deck.UserID = userID
+
+	deck.Name = strings.TrimSpace(deck.Name)
+	if deck.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	// A deck created with a predicate is a smart deck
+	var predicate interface{}
+	if deck.Predicate != nil && string(deck.Predicate) != "null" {
+		if _, _, err := parsePredicate(deck.Predicate); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		predicate = string(deck.Predicate)
+	}
+
+	var id int
+	err := database.DB.QueryRow(
+		"INSERT INTO decks (user_id, language_id, name, description, predicate) VALUES (?, ?, ?, ?, ?) ON CONFLICT(language_id, name) DO NOTHING RETURNING id",
+		deck.UserID, deck.LanguageID, deck.Name, deck.Description, predicate).Scan(&id)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusConflict, "Deck \""+deck.Name+"\" already exists in this language")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	deck, err = loadDeck(database.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deck)
+}
+
+func UpdateDeck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid deck id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeDeck(w, userID, id) {
+		return
+	}
+
+	var update DeckUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The name, description and predicate change together or not at all
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if update.Predicate != nil {
+		var smart bool
+		if err := tx.QueryRow("SELECT predicate IS NOT NULL FROM decks WHERE id = ?", id).Scan(&smart); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !smart {
+			writeError(w, http.StatusConflict, "Only smart decks have a predicate")
+			return
+		}
+		if _, _, err := parsePredicate(*update.Predicate); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			http.Error(w, "name must not be empty", http.StatusBadRequest)
+			return
+		}
+		var conflictID int
+		err := tx.QueryRow(
+			"SELECT id FROM decks WHERE name = ? AND id != ? AND language_id = (SELECT language_id FROM decks WHERE id = ?)",
+			name, id, id,
+		).Scan(&conflictID)
+		if err == nil {
+			writeError(w, http.StatusConflict, "Deck \""+name+"\" already exists in this language")
+			return
+		}
+		if err != sql.ErrNoRows {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec("UPDATE decks SET name = ? WHERE id = ?", name, id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if update.Description != nil {
+		if _, err := tx.Exec("UPDATE decks SET description = ? WHERE id = ?", *update.Description, id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if update.Predicate != nil {
+		if _, err := tx.Exec("UPDATE decks SET predicate = ? WHERE id = ?", string(*update.Predicate), id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	deck, err := loadDeck(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deck)
+}
+
+// DeleteDeck removes a deck; the items in it are kept.
+func DeleteDeck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid deck id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeDeck(w, userID, id) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM deck_items WHERE deck_id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM decks WHERE id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeckItems lists a deck's items in deck order. A smart deck's predicate
+// is evaluated on every call, and its matches are listed oldest first.
+func GetDeckItems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid deck id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeDeck(w, userID, id) {
+		return
+	}
+
+	deck, err := loadDeck(database.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	from := " FROM deck_items di JOIN learning_items li ON li.id = di.item_id WHERE di.deck_id = ? ORDER BY di.position"
+	args := []interface{}{id}
+	if deck.Predicate != nil {
+		matches, matchArgs, err := smartDeckItems(deck.UserID, deck.LanguageID, deck.Predicate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		from = " FROM learning_items li WHERE li.id IN (" + matches + ") ORDER BY li.created_at, li.id"
+		args = matchArgs
+	}
+
+	rows, err := database.DB.Query(
+		`SELECT li.id, li.user_id, li.language_id, li.type, li.content,
+		COALESCE(li.translation, ''), COALESCE(li.meaning, ''), COALESCE(li.pronunciation, ''),
+		COALESCE(li.example_usage, ''), COALESCE(li.notes, ''), li.created_at,
+		`+store.ItemHasAudio+`, `+itemTagsJSON()+from, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	items := []models.DeckItem{}
+	for rows.Next() {
+		var item models.DeckItem
+		var tags string
+		err := rows.Scan(&item.ID, &item.UserID, &item.LanguageID, &item.Type, &item.Content,
+			&item.Translation, &item.Meaning, &item.Pronunciation, &item.ExampleUsage, &item.Notes,
+			&item.CreatedAt, &item.HasAudio, &tags)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		item.Tags = decodeTags(tags)
+		item.Position = len(items) + 1
+		items = append(items, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// AddDeckItems inserts items into a deck at the requested position, or at
+// the end. Items already in the deck are left where they are.
+func AddDeckItems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deck, req, ok := decodeDeckItemsRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Position < 0 {
+		http.Error(w, "position must be positive", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var added []int
+	for _, itemID := range req.ItemIDs {
+		var exists bool
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM deck_items WHERE deck_id = ? AND item_id = ?)", deck.ID, itemID).Scan(&exists)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			added = append(added, itemID)
+		}
+	}
+
+	position := deck.ItemCount + 1
+	if req.Position > 0 && req.Position < position {
+		position = req.Position
+		_, err := tx.Exec("UPDATE deck_items SET position = position + ? WHERE deck_id = ? AND position >= ?",
+			len(added), deck.ID, position)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for i, itemID := range added {
+		if _, err := tx.Exec("INSERT INTO deck_items (deck_id, item_id, position) VALUES (?, ?, ?)", deck.ID, itemID, position+i); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeDeck(w, tx, deck.ID)
+}
+
+// ReorderDeckItems sets the order of a deck's items. item_ids must list
+// every item in the deck exactly once.
+func ReorderDeckItems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deck, req, ok := decodeDeckItemsRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var matched int
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM deck_items WHERE deck_id = ? AND item_id IN ("+placeholders(len(req.ItemIDs))+")",
+		append([]interface{}{deck.ID}, intArgs(req.ItemIDs)...)...,
+	).Scan(&matched)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if matched != deck.ItemCount || len(req.ItemIDs) != deck.ItemCount {
+		http.Error(w, "item_ids must list every item in the deck exactly once", http.StatusBadRequest)
+		return
+	}
+
+	for i, itemID := range req.ItemIDs {
+		if _, err := tx.Exec("UPDATE deck_items SET position = ? WHERE deck_id = ? AND item_id = ?", i+1, deck.ID, itemID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeDeck(w, tx, deck.ID)
+}
+
+// RemoveDeckItem takes the itemID item out of a deck and closes the gap it
+// leaves.
+func RemoveDeckItem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid deck id", http.StatusBadRequest)
+		return
+	}
+	itemID, err := strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeDeck(w, userID, id) {
+		return
+	}
+
+	deck, err := loadDeck(database.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rejectSmartDeck(w, deck) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var position int
+	err = tx.QueryRow("SELECT position FROM deck_items WHERE deck_id = ? AND item_id = ?", id, itemID).Scan(&position)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Item is not in this deck")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM deck_items WHERE deck_id = ? AND item_id = ?", id, itemID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("UPDATE deck_items SET position = position - 1 WHERE deck_id = ? AND position > ?", id, position); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeDeck(w, tx, id)
+}
+
+// decodeDeckItemsRequest authorizes the deck in the path and reads the
+// request body, checking that every item belongs to the deck's language.
+func decodeDeckItemsRequest(w http.ResponseWriter, r *http.Request) (models.Deck, DeckItemsRequest, bool) {
+	var req DeckItemsRequest
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return models.Deck{}, req, false
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid deck id", http.StatusBadRequest)
+		return models.Deck{}, req, false
+	}
+	if !authorizeDeck(w, userID, id) {
+		return models.Deck{}, req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return models.Deck{}, req, false
+	}
+
+	deck, err := loadDeck(database.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return deck, req, false
+	}
+	if rejectSmartDeck(w, deck) {
+		return deck, req, false
+	}
+
+	seen := map[int]bool{}
+	for _, itemID := range req.ItemIDs {
+		if seen[itemID] {
+			http.Error(w, "item_ids must not repeat an item", http.StatusBadRequest)
+			return deck, req, false
+		}
+		seen[itemID] = true
+	}
+	if len(req.ItemIDs) == 0 {
+		return deck, req, true
+	}
+
+	var matched int
+	err = database.DB.QueryRow(
+		"SELECT COUNT(*) FROM learning_items WHERE user_id = ? AND language_id = ? AND id IN ("+placeholders(len(req.ItemIDs))+")",
+		append([]interface{}{userID, deck.LanguageID}, intArgs(req.ItemIDs)...)...,
+	).Scan(&matched)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return deck, req, false
+	}
+	if matched != len(req.ItemIDs) {
+		http.Error(w, "item_ids must be your items in the deck's language", http.StatusBadRequest)
+		return deck, req, false
+	}
+	return deck, req, true
+}
+
+// writeDeck commits tx and responds with the deck.
+func writeDeck(w http.ResponseWriter, tx *sql.Tx, id int) {
+	deck, err := loadDeck(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deck)
+}
+
+// removeFromOtherLanguageDecks takes an item out of every deck not in
+// languageID, closing the gaps it leaves.
+func removeFromOtherLanguageDecks(tx *sql.Tx, itemID, languageID int) error {
+	_, err := tx.Exec(
+		`UPDATE deck_items SET position = position - 1
+		WHERE position > (SELECT di.position FROM deck_items di WHERE di.deck_id = deck_items.deck_id AND di.item_id = ?)
+		AND deck_id IN (SELECT id FROM decks WHERE language_id != ?)`,
+		itemID, languageID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"DELETE FROM deck_items WHERE item_id = ? AND deck_id IN (SELECT id FROM decks WHERE language_id != ?)",
+		itemID, languageID)
+	return err
+}
+
+// deckScope restricts a flashcard query to the items of a deck.
+type deckScope struct {
+	languageID int
+	where      string
+	args       []interface{}
+	order      string // ORDER BY expression for deck order, empty for smart decks
+	orderArgs  []interface{}
+}
+
+// deckFilter scopes a flashcard query to the deck_id deck, after checking
+// the caller owns it. Without a deck_id the scope is empty.
+func deckFilter(w http.ResponseWriter, userID int, deckParam string) (deckScope, bool) {
+	if deckParam == "" {
+		return deckScope{}, true
+	}
+	deckID, err := strconv.Atoi(deckParam)
+	if err != nil {
+		http.Error(w, "invalid deck_id", http.StatusBadRequest)
+		return deckScope{}, false
+	}
+	if !authorizeDeck(w, userID, deckID) {
+		return deckScope{}, false
+	}
+
+	deck, err := scanDeck(database.DB.QueryRow(deckQuery+" WHERE d.id = ?", deckID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return deckScope{}, false
+	}
+	scope := deckScope{languageID: deck.LanguageID}
+
+	if deck.Predicate != nil {
+		matches, args, err := smartDeckItems(deck.UserID, deck.LanguageID, deck.Predicate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return deckScope{}, false
+		}
+		scope.where = " AND li.id IN (" + matches + ")"
+		scope.args = args
+		return scope, true
+	}
+
+	scope.where = " AND li.id IN (SELECT item_id FROM deck_items WHERE deck_id = ?)"
+	scope.args = []interface{}{deckID}
+	scope.order = "(SELECT position FROM deck_items WHERE deck_id = ? AND item_id = li.id)"
+	scope.orderArgs = []interface{}{deckID}
+	return scope, true
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// lowerPlaceholders is placeholders for values compared in any case.
+func lowerPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("LOWER(?), ", n), ", ")
+}
+
+func intArgs(ids []int) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
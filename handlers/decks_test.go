@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"language-learner/database"
+	"language-learner/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUpdateDeck(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		f := newReviewFixture(t)
+		ctx := context.WithValue(context.Background(), userIDKey, f.userID)
+		var smartID, otherID int
+		for name, predicate := range map[string]interface{}{"Greetings": `{"field": "tag", "op": "eq", "value": "greeting"}`, "Animals": nil} {
+			var id int
+			err := database.DB.QueryRow("INSERT INTO decks (user_id, language_id, name, description, predicate) VALUES (?, ?, ?, '', ?) RETURNING id",
+				f.userID, f.languageID, name, predicate).Scan(&id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if predicate != nil {
+				smartID = id
+			} else {
+				otherID = id
+			}
+		}
+		update := func(id int, body string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest(http.MethodPatch, "/decks/"+strconv.Itoa(id), strings.NewReader(body)).WithContext(ctx)
+			r.SetPathValue("id", strconv.Itoa(id))
+			w := httptest.NewRecorder()
+			UpdateDeck(w, r)
+			return w
+		}
+
+		w := update(smartID, `{"name": " Animales ", "description": "reviewed", "predicate": {"field": "tag", "op": "eq", "value": "animals"}}`)
+		var deck models.Deck
+		if err := json.NewDecoder(w.Body).Decode(&deck); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("UpdateDeck = %d, %v", w.Code, err)
+		}
+		if deck.Name != "Animales" || deck.Description != "reviewed" || deck.ItemCount != 1 {
+			t.Errorf("updated deck = %+v", deck)
+		}
+
+		for _, tt := range []struct {
+			id   int
+			body string
+			want int
+		}{
+			{otherID, `{"name": "Animales", "description": "lost"}`, http.StatusConflict},
+			{otherID, `{"description": "lost", "predicate": {"all": []}}`, http.StatusConflict},
+			{smartID, `{"description": "lost", "predicate": {"field": "nope"}}`, http.StatusBadRequest},
+		} {
+			if w := update(tt.id, tt.body); w.Code != tt.want {
+				t.Errorf("%s: status %d, want %d", tt.body, w.Code, tt.want)
+			}
+		}
+		var description string
+		if err := database.DB.QueryRow("SELECT COALESCE(description, '') FROM decks WHERE id = ?", otherID).Scan(&description); err != nil || description != "" {
+			t.Errorf("rejected updates changed the description to %q, %v", description, err)
+		}
+	})
+}
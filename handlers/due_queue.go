@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"language-learner/database"
+	"language-learner/dates"
+	"language-learner/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultDueBatchSize = 20
+
+// GetDueFlashcards returns the next batch of cards to study for a language:
+// reviews whose due date has passed, mixed with never-seen items, within the
+// user's daily new card and review limits. With deck_id only the deck's items
+// are studied, and new cards are introduced in deck order.
+func GetDueFlashcards(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	deck, ok := deckFilter(w, userID, r.URL.Query().Get("deck_id"))
+	if !ok {
+		return
+	}
+
+	languageID, err := strconv.Atoi(r.URL.Query().Get("language_id"))
+	if err != nil && deck.languageID != 0 {
+		languageID, err = deck.languageID, nil
+	}
+	if err != nil {
+		http.Error(w, "language_id parameter required", http.StatusBadRequest)
+		return
+	}
+	if !authorizeLanguage(w, userID, languageID) {
+		return
+	}
+
+	batchSize := defaultDueBatchSize
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		batchSize, err = strconv.Atoi(limit)
+		if err != nil || batchSize <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	settings, err := loadUserSettings(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := refreshStaleCardStates(userID, languageID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	newDone, reviewsDone, err := countStudiedToday(userID, dates.StartOfDay(now, userLocation(settings)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	queue := models.DueQueue{
+		NewRemaining:     max(settings.NewCardsPerDay-newDone, 0),
+		ReviewsRemaining: max(settings.ReviewsPerDay-reviewsDone, 0),
+	}
+
+	nowText := formatNullableTime(now)
+	err = database.DB.QueryRow(
+		"SELECT COUNT(*) FROM card_states cs JOIN learning_items li ON li.id = cs.item_id WHERE cs.user_id = ? AND li.language_id = ? AND cs.due_at <= ?"+deck.where,
+		append([]interface{}{userID, languageID, nowText}, deck.args...)...,
+	).Scan(&queue.DueCount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	reviewArgs := append([]interface{}{userID, languageID, nowText}, deck.args...)
+	reviews, err := queryFlashcards(
+		" WHERE li.user_id = ? AND li.language_id = ? AND cs.due_at <= ?"+deck.where+" ORDER BY cs.due_at LIMIT ?",
+		append(reviewArgs, min(queue.ReviewsRemaining, batchSize))...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Oldest items first so new cards are introduced in the order they were logged
+	newOrder := "li.created_at, li.id"
+	newArgs := append([]interface{}{userID, languageID}, deck.args...)
+	if deck.order != "" {
+		newOrder = deck.order
+		newArgs = append(newArgs, deck.orderArgs...)
+	}
+	newCards, err := queryFlashcards(
+		" WHERE li.user_id = ? AND li.language_id = ? AND NOT EXISTS (SELECT 1 FROM flashcard_sessions s WHERE s.item_id = li.id)"+deck.where+" ORDER BY "+newOrder+" LIMIT ?",
+		append(newArgs, min(queue.NewRemaining, batchSize-len(reviews)))...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	queue.Cards = interleave(reviews, newCards)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(queue)
+}
+
+func queryFlashcards(where string, args ...interface{}) ([]models.FlashcardItem, error) {
+	rows, err := database.DB.Query(flashcardQuery()+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanFlashcards(rows)
+}
+
+// refreshStaleCardStates rebuilds card state for reviewed items that have
+// none yet, or whose state was computed by a different scheduler.
+func refreshStaleCardStates(userID, languageID int) error {
+	rows, err := database.DB.Query(
+		`SELECT DISTINCT fs.item_id FROM flashcard_sessions fs
+		JOIN learning_items li ON li.id = fs.item_id
+		LEFT JOIN card_states cs ON cs.item_id = fs.item_id
+		WHERE fs.user_id = ? AND li.language_id = ? AND (cs.item_id IS NULL OR cs.algorithm != ?)`,
+		userID, languageID, cardScheduler.Name())
+	if err != nil {
+		return err
+	}
+
+	var itemIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		itemIDs = append(itemIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range itemIDs {
+		if _, err := refreshCardState(userID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countStudiedToday counts today's new cards (items first shown since
+// dayStart) and reviews (answers on items first shown before dayStart).
+func countStudiedToday(userID int, dayStart time.Time) (newDone, reviewsDone int, err error) {
+	err = database.DB.QueryRow(
+		`SELECT
+			COUNT(DISTINCT CASE WHEN first.first_shown >= ? THEN fs.item_id END),
+			COUNT(CASE WHEN first.first_shown < ? THEN fs.id END)
+		FROM flashcard_sessions fs
+		JOIN (SELECT item_id, MIN(shown_at) AS first_shown FROM flashcard_sessions
+			WHERE user_id = ? GROUP BY item_id) first ON first.item_id = fs.item_id
+		WHERE fs.user_id = ? AND fs.shown_at >= ?`,
+		formatNullableTime(dayStart), formatNullableTime(dayStart), userID, userID, formatNullableTime(dayStart),
+	).Scan(&newDone, &reviewsDone)
+	return newDone, reviewsDone, err
+}
+
+// interleave spreads newCards evenly between reviews.
+func interleave(reviews, newCards []models.FlashcardItem) []models.FlashcardItem {
+	cards := make([]models.FlashcardItem, 0, len(reviews)+len(newCards))
+	if len(newCards) == 0 {
+		return append(cards, reviews...)
+	}
+
+	step := len(reviews)/len(newCards) + 1
+	r := 0
+	for _, card := range newCards {
+		for i := 1; i < step && r < len(reviews); i++ {
+			cards = append(cards, reviews[r])
+			r++
+		}
+		cards = append(cards, card)
+	}
+	return append(cards, reviews[r:]...)
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"language-learner/anki"
+	"language-learner/database"
+	"language-learner/models"
+	"language-learner/scheduler"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// exportColumns are the CSV export columns, named after importFields so an
+// export can be imported again without a mapping.
+var exportColumns = []string{"type", "content", "translation", "meaning", "pronunciation", "example_usage", "notes", "tags"}
+
+// audioExtensions names exported recordings, since mime.ExtensionsByType
+// doesn't know most audio types on minimal systems.
+var audioExtensions = map[string]string{
+	"audio/mpeg":  ".mp3",
+	"audio/mp4":   ".m4a",
+	"audio/x-m4a": ".m4a",
+	"audio/aac":   ".aac",
+	"audio/ogg":   ".ogg",
+	"audio/webm":  ".webm",
+	"audio/wav":   ".wav",
+	"audio/x-wav": ".wav",
+	"audio/wave":  ".wav",
+	"audio/flac":  ".flac",
+}
+
+// ExportLearningItems downloads the caller's items as an Anki package or a
+// CSV file. Query parameters:
+//
+//   - format: apkg (default) or csv
+//   - language_id, type, tags/tag_mode and deck_id select the items, as for
+//     GetLearningItems and GetFlashcards; without any, every item is exported
+//   - include_reviews: false to leave the review history out of a package
+//
+// A package holds one deck, named after the deck or language exported, with
+// a forward card per item and a reverse card for items with a translation.
+// Scheduling state and review history carry over: sessions are replayed
+// through the scheduler to recover the interval after each answer, and each
+// lands on the card for its direction.
+func ExportLearningItems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = "apkg"
+	}
+	if format != "apkg" && format != "csv" {
+		http.Error(w, "format must be apkg or csv", http.StatusBadRequest)
+		return
+	}
+
+	query := flashcardQuery() + " WHERE li.user_id = ?"
+	args := []interface{}{userID}
+
+	deck, ok := deckFilter(w, userID, params.Get("deck_id"))
+	if !ok {
+		return
+	}
+	query += deck.where
+	args = append(args, deck.args...)
+
+	name := "Language Learner"
+	if v := params.Get("language_id"); v != "" {
+		languageID, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid language_id", http.StatusBadRequest)
+			return
+		}
+		if !authorizeLanguage(w, userID, languageID) {
+			return
+		}
+		if err := database.DB.QueryRow(
+			"SELECT language_name FROM languages WHERE id = ?", languageID,
+		).Scan(&name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		query += " AND li.language_id = ?"
+		args = append(args, languageID)
+	}
+	if deckID := params.Get("deck_id"); deckID != "" {
+		if err := database.DB.QueryRow("SELECT name FROM decks WHERE id = ?", deckID).Scan(&name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if itemType := params.Get("type"); itemType != "" {
+		if !validItemTypes[itemType] {
+			http.Error(w, "type must be one of word, sentence, grammar, letter", http.StatusBadRequest)
+			return
+		}
+		query += " AND li.type = ?"
+		args = append(args, itemType)
+	}
+
+	tagClause, tagArgs, err := tagFilter(userID, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query += tagClause
+	args = append(args, tagArgs...)
+
+	if deck.order != "" {
+		query += " ORDER BY " + deck.order
+		args = append(args, deck.orderArgs...)
+	} else {
+		query += " ORDER BY li.created_at, li.id"
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items, err := scanFlashcards(rows)
+	rows.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format == "csv" {
+		writeItemsCSV(w, name, items)
+		return
+	}
+
+	var sessions map[int][]models.FlashcardSession
+	if params.Get("include_reviews") != "false" {
+		if sessions, err = loadUserSessions(userID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	notes := make([]anki.ExportNote, 0, len(items))
+	for _, item := range items {
+		note, err := exportNote(item, sessions[item.ID])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		notes = append(notes, note)
+	}
+
+	w.Header().Set("Content-Type", "application/apkg")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".apkg"}))
+	if err := anki.WritePackage(w, name, notes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeItemsCSV(w http.ResponseWriter, name string, items []models.FlashcardItem) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".csv"}))
+
+	cw := csv.NewWriter(w)
+	cw.Write(exportColumns)
+	for _, item := range items {
+		cw.Write([]string{item.Type, item.Content, item.Translation, item.Meaning, item.Pronunciation,
+			item.ExampleUsage, item.Notes, strings.Join(item.Tags, ", ")})
+	}
+	cw.Flush()
+}
+
+// loadUserSessions returns the user's sessions by item, oldest first.
+func loadUserSessions(userID int) (map[int][]models.FlashcardSession, error) {
+	rows, err := database.DB.Query(
+		`SELECT item_id, shown_at, was_correct, grade, response_ms, COALESCE(direction, '')
+		FROM flashcard_sessions WHERE user_id = ? ORDER BY item_id, shown_at, id`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make(map[int][]models.FlashcardSession)
+	for rows.Next() {
+		var s models.FlashcardSession
+		var grade sql.NullInt64
+		if err := rows.Scan(&s.ItemID, &s.ShownAt, &s.WasCorrect, &grade, &s.ResponseMs, &s.Direction); err != nil {
+			return nil, err
+		}
+		// Sessions recorded before grades existed only have pass/fail
+		s.Grade = scheduler.Grade(grade.Int64)
+		if !grade.Valid {
+			s.Grade = scheduler.GradeFromCorrect(s.WasCorrect)
+		}
+		sessions[s.ItemID] = append(sessions[s.ItemID], s)
+	}
+	return sessions, rows.Err()
+}
+
+// exportNote converts an item and its sessions to an Anki note. The item's
+// card state belongs to the forward card; the reverse card keeps only its
+// history, and reverse sessions of items without a translation go to the
+// forward card.
+func exportNote(item models.FlashcardItem, sessions []models.FlashcardSession) (anki.ExportNote, error) {
+	note := anki.ExportNote{
+		GUID:    anki.GUID("language-learner:" + strconv.Itoa(item.UserID) + ":" + strconv.Itoa(item.ID)),
+		Created: item.CreatedAt,
+		Fields:  []string{item.Content, item.Translation, item.Meaning, item.Pronunciation, item.ExampleUsage, item.Notes},
+		Tags:    make([]string, len(item.Tags)),
+	}
+	// Anki separates tags with spaces
+	for i, tag := range item.Tags {
+		note.Tags[i] = strings.Join(strings.Fields(tag), "_")
+	}
+	if item.Translation != "" {
+		note.Reverse = &anki.ExportCard{}
+	}
+
+	var state scheduler.CardState
+	for _, s := range sessions {
+		previous := state
+		state = cardScheduler.Next(state, scheduler.Review{At: s.ShownAt, Grade: s.Grade})
+
+		review := anki.Review{
+			At:               s.ShownAt,
+			Ease:             int(s.Grade),
+			IntervalDays:     state.IntervalDays,
+			LastIntervalDays: previous.IntervalDays,
+		}
+		if s.ResponseMs != nil {
+			review.TimeMs = *s.ResponseMs
+		}
+		if previous.IntervalDays >= 1 {
+			review.Type = 1
+		}
+
+		card := &note.Forward
+		if s.Direction == "reverse" && note.Reverse != nil {
+			card = note.Reverse
+		}
+		card.Reviews = append(card.Reviews, review)
+	}
+	if len(sessions) > 0 {
+		note.Forward.Due = state.Due
+		note.Forward.IntervalDays = state.IntervalDays
+		note.Forward.Ease = state.Ease
+		note.Forward.Reps = state.Reps
+		note.Forward.Lapses = state.Lapses
+	}
+
+	if !item.HasAudio {
+		return note, nil
+	}
+	mimeType, err := itemAudioType(item.ID)
+	if err == sql.ErrNoRows {
+		return note, nil
+	}
+	if err != nil {
+		return note, err
+	}
+	ext, ok := audioExtensions[mimeType]
+	if !ok {
+		ext = ".audio"
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	// The recording is read when the package writes it, not held with the note
+	note.LoadAudio = func() ([]byte, error) {
+		_, data, err := loadItemAudio(item.ID)
+		return data, err
+	}
+	note.AudioName = "language-learner-" + strconv.Itoa(item.ID) + ext
+	return note, nil
+}
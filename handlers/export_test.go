@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bytes"
+	"language-learner/anki"
+	"language-learner/database"
+	"language-learner/models"
+	"testing"
+)
+
+func TestExportNoteLoadsAudioLazily(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		f := newReviewFixture(t)
+		audio := bytes.Repeat([]byte{2}, 4096)
+		if err := database.Store.SaveItemAudio(&models.ItemAudio{ItemID: f.hola, MimeType: "audio/mpeg"}, audio); err != nil {
+			t.Fatal(err)
+		}
+		legacy := "data:audio/ogg;base64,T2dnUw=="
+		if _, err := database.DB.Exec("UPDATE learning_items SET audio_data = ? WHERE id = ?", legacy, f.gato); err != nil {
+			t.Fatal(err)
+		}
+
+		cards, err := queryFlashcards(" WHERE li.user_id = ? ORDER BY li.id", f.userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var notes []anki.ExportNote
+		for _, card := range cards {
+			note, err := exportNote(card, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			notes = append(notes, note)
+		}
+		if notes[2].LoadAudio != nil {
+			t.Errorf("adiós has no recording but got %q", notes[2].AudioName)
+		}
+
+		// Replacing a recording after building the notes shows it is read
+		// when the package is written
+		audio = bytes.Repeat([]byte{3}, 2048)
+		if err := database.Store.SaveItemAudio(&models.ItemAudio{ItemID: f.hola, MimeType: "audio/mpeg"}, audio); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := anki.WritePackage(&buf, "Spanish", notes); err != nil {
+			t.Fatal(err)
+		}
+		pkg, err := anki.Read(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string][]byte{notes[0].AudioName: audio, notes[1].AudioName: []byte("OggS")} {
+			if data, err := pkg.Media(name, maxAudioBytes); err != nil || !bytes.Equal(data, want) {
+				t.Errorf("media %s = %d bytes, %v, want %d bytes", name, len(data), err, len(want))
+			}
+		}
+	})
+}
@@ -4,35 +4,50 @@ import (
 	"database/sql"
 	"encoding/json"
 	"language-learner/database"
+	"language-learner/dates"
 	"language-learner/models"
+	"language-learner/scheduler"
+	"language-learner/store"
 	"net/http"
 	"time"
 )
 
+// Review stats of the item aliased li, counted over its owner's sessions.
+const (
+	lastReviewedSQL = `(SELECT MAX(fs.shown_at) FROM flashcard_sessions fs WHERE fs.item_id = li.id AND fs.user_id = li.user_id)`
+	reviewCountSQL  = `(SELECT COUNT(*) FROM flashcard_sessions fs WHERE fs.item_id = li.id AND fs.user_id = li.user_id)`
+	correctCountSQL = `(SELECT COUNT(*) FROM flashcard_sessions fs WHERE fs.item_id = li.id AND fs.user_id = li.user_id AND fs.was_correct = 1)`
+)
+
+// flashcardQuery selects learning items with their review stats and card
+// state. Callers append WHERE conditions on li and cs.
+func flashcardQuery() string {
+	return `SELECT li.id, li.user_id, li.language_id, li.type, li.content,
+		li.translation, li.meaning, li.pronunciation, li.example_usage, li.notes, li.created_at,
+		` + store.ItemHasAudio + `, ` + itemTagsJSON() + `,
+		` + lastReviewedSQL + ` AS last_reviewed,
+		` + reviewCountSQL + ` AS review_count,
+		` + correctCountSQL + ` AS correct_count,
+		cs.due_at, cs.interval_days, cs.ease, cs.stability
+		FROM learning_items li
+		LEFT JOIN card_states cs ON cs.item_id = li.id`
+}
+
 func GetFlashcards(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID := r.URL.Query().Get("user_id")
-	languageID := r.URL.Query().Get("language_id")
-	dateFilter := r.URL.Query().Get("date_filter") // day, week, month, biweekly, all
-
-	if userID == "" {
-		http.Error(w, "user_id parameter required", http.StatusBadRequest)
+	userID, ok := requireUser(w, r)
+	if !ok {
 		return
 	}
 
+	languageID := r.URL.Query().Get("language_id")
+
 	// Build query to get learning items with flashcard stats
-	query := `SELECT li.id, li.user_id, li.language_id, li.type, li.content, 
-		li.translation, li.meaning, li.pronunciation, li.example_usage, li.notes, li.created_at,
-		MAX(fs.shown_at) as last_reviewed,
-		COUNT(fs.id) as review_count,
-		SUM(CASE WHEN fs.was_correct = 1 THEN 1 ELSE 0 END) as correct_count
-		FROM learning_items li
-		LEFT JOIN flashcard_sessions fs ON li.id = fs.item_id
-		WHERE li.user_id = ?`
+	query := flashcardQuery() + " WHERE li.user_id = ?"
 
 	args := []interface{}{userID}
 	if languageID != "" {
@@ -40,25 +55,42 @@ func GetFlashcards(w http.ResponseWriter, r *http.Request) {
 		args = append(args, languageID)
 	}
 
+	tagClause, tagArgs, err := tagFilter(userID, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query += tagClause
+	args = append(args, tagArgs...)
+
+	deck, ok := deckFilter(w, userID, r.URL.Query().Get("deck_id"))
+	if !ok {
+		return
+	}
+	query += deck.where
+	args = append(args, deck.args...)
+
 	// Apply date filter to learning items
-	if dateFilter != "" && dateFilter != "all" {
-		var timeThreshold time.Time
-		now := time.Now()
-		switch dateFilter {
-		case "day":
-			timeThreshold = now.AddDate(0, 0, -1)
-		case "week":
-			timeThreshold = now.AddDate(0, 0, -7)
-		case "biweekly":
-			timeThreshold = now.AddDate(0, 0, -14)
-		case "month":
-			timeThreshold = now.AddDate(0, -1, 0)
-		}
+	created, ok := createdRange(w, userID, r.URL.Query())
+	if !ok {
+		return
+	}
+	if !created.From.IsZero() {
 		query += " AND li.created_at >= ?"
-		args = append(args, timeThreshold.Format(time.RFC3339))
+		args = append(args, formatNullableTime(created.From))
+	}
+	if !created.To.IsZero() {
+		query += " AND li.created_at < ?"
+		args = append(args, formatNullableTime(created.To))
 	}
 
-	query += " GROUP BY li.id ORDER BY li.created_at DESC"
+	// Decks are studied in deck order
+	if deck.order != "" {
+		query += " ORDER BY " + deck.order
+		args = append(args, deck.orderArgs...)
+	} else {
+		query += " ORDER BY li.created_at DESC"
+	}
 
 	rows, err := database.DB.Query(query, args...)
 	if err != nil {
@@ -67,30 +99,10 @@ func GetFlashcards(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	var flashcards []models.FlashcardItem
-	for rows.Next() {
-		var card models.FlashcardItem
-		var createdAt, lastReviewed sql.NullString
-		var reviewCount, correctCount sql.NullInt64
-
-		err := rows.Scan(&card.ID, &card.UserID, &card.LanguageID, &card.Type,
-			&card.Content, &card.Translation, &card.Meaning, &card.Pronunciation,
-			&card.ExampleUsage, &card.Notes, &createdAt, &lastReviewed,
-			&reviewCount, &correctCount)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		card.CreatedAt, _ = time.Parse(time.RFC3339, createdAt.String)
-		if lastReviewed.Valid {
-			t, _ := time.Parse(time.RFC3339, lastReviewed.String)
-			card.LastReviewed = &t
-		}
-		card.ReviewCount = int(reviewCount.Int64)
-		card.CorrectCount = int(correctCount.Int64)
-
-		flashcards = append(flashcards, card)
+	flashcards, err := scanFlashcards(rows)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -103,31 +115,115 @@ func RecordFlashcardSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	var session models.FlashcardSession
 	if err := json.NewDecoder(r.Body).Decode(&session); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := `INSERT INTO flashcard_sessions (user_id, language_id, item_id, was_correct)
-		VALUES (?, ?, ?, ?)`
-
-	wasCorrect := 0
-	if session.WasCorrect {
-		wasCorrect = 1
+	if !checkBodyUser(w, session.UserID, userID) || !authorizeItem(w, userID, session.ItemID) {
+		return
 	}
+	session.UserID = userID
 
-	result, err := database.DB.Exec(query, session.UserID, session.LanguageID, session.ItemID, wasCorrect)
+	// The language always comes from the item so sessions can't be filed
+	// under another user's language.
+	item, err := database.Store.GetItem(session.ItemID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	session.LanguageID = item.LanguageID
+
+	// Older clients only send was_correct; newer ones send a grade, which
+	// decides was_correct so pass/fail stats stay comparable.
+	if session.Grade == 0 {
+		session.Grade = scheduler.GradeFromCorrect(session.WasCorrect)
+	} else if !session.Grade.Valid() {
+		http.Error(w, "grade must be again, hard, good or easy", http.StatusBadRequest)
+		return
+	}
+	session.WasCorrect = session.Grade.Correct()
+
+	if session.ResponseMs != nil && *session.ResponseMs < 0 {
+		http.Error(w, "response_ms must not be negative", http.StatusBadRequest)
+		return
+	}
 
-	id, _ := result.LastInsertId()
-	session.ID = int(id)
-	session.ShownAt = time.Now()
+	if session.Direction != "" && session.Direction != "forward" && session.Direction != "reverse" {
+		http.Error(w, "direction must be forward or reverse", http.StatusBadRequest)
+		return
+	}
+
+	// Sessions are always recorded as happening now
+	session.ShownAt = time.Time{}
+	if err := database.Store.CreateSession(&session); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := refreshCardState(userID, session.ItemID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(session)
 }
 
+// insertSession records a past session, keeping its shown_at. The caller
+// refreshes the item's card state once its history is complete.
+func insertSession(tx *sql.Tx, s models.FlashcardSession) error {
+	return database.Store.WithTx(tx).CreateSession(&s)
+}
+
+
+func scanFlashcards(rows *sql.Rows) ([]models.FlashcardItem, error) {
+	var flashcards []models.FlashcardItem
+	for rows.Next() {
+		var card models.FlashcardItem
+		var createdAt, lastReviewed sql.NullString
+		var tags string
+		var reviewCount, correctCount sql.NullInt64
+		var dueAt sql.NullTime
+		var intervalDays, ease, stability sql.NullFloat64
+
+		err := rows.Scan(&card.ID, &card.UserID, &card.LanguageID, &card.Type,
+			&card.Content, &card.Translation, &card.Meaning, &card.Pronunciation,
+			&card.ExampleUsage, &card.Notes, &createdAt, &card.HasAudio, &tags, &lastReviewed,
+			&reviewCount, &correctCount, &dueAt, &intervalDays, &ease, &stability)
+		if err != nil {
+			return nil, err
+		}
+
+		if createdAt.Valid {
+			if card.CreatedAt, err = dates.Parse(createdAt.String); err != nil {
+				return nil, err
+			}
+		}
+		card.Tags = decodeTags(tags)
+		if lastReviewed.Valid {
+			t, err := dates.Parse(lastReviewed.String)
+			if err != nil {
+				return nil, err
+			}
+			card.LastReviewed = &t
+		}
+		card.ReviewCount = int(reviewCount.Int64)
+		card.CorrectCount = int(correctCount.Int64)
+		if dueAt.Valid {
+			card.DueAt = &dueAt.Time
+		}
+		card.IntervalDays = intervalDays.Float64
+		card.Ease = ease.Float64
+		card.Stability = stability.Float64
+
+		flashcards = append(flashcards, card)
+	}
+	return flashcards, rows.Err()
+}
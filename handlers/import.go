@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"language-learner/database"
+	"language-learner/models"
+	"language-learner/normalize"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxImportBytes = 5 << 20
+	maxImportRows  = 10000
+)
+
+// importFields are the LearningItem fields a column can be mapped to.
+// Tags are separated by commas within their cell.
+var importFields = map[string]func(*models.LearningItem, string){
+	"type":          func(item *models.LearningItem, v string) { item.Type = v },
+	"content":       func(item *models.LearningItem, v string) { item.Content = v },
+	"translation":   func(item *models.LearningItem, v string) { item.Translation = v },
+	"meaning":       func(item *models.LearningItem, v string) { item.Meaning = v },
+	"pronunciation": func(item *models.LearningItem, v string) { item.Pronunciation = v },
+	"example_usage": func(item *models.LearningItem, v string) { item.ExampleUsage = v },
+	"notes":         func(item *models.LearningItem, v string) { item.Notes = v },
+	"tags": func(item *models.LearningItem, v string) {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				item.Tags = append(item.Tags, tag)
+			}
+		}
+	},
+}
+
+// ImportLearningItems bulk-creates items in one language from a CSV or TSV
+// file, sent either as the "file" field of a multipart form or as the raw
+// request body. Options come from the query string or form:
+//
+//   - language_id: the language of every imported item (required)
+//   - format: csv or tsv; guessed from the file name or content by default
+//   - header: false if the first line is data rather than column names
+//   - mapping: a JSON object from column name, or 1-based column number, to
+//     item field; without one, columns named after fields are used
+//   - type: the type of rows that don't map one, word by default
+//   - allow_duplicate: true to import rows matching existing items
+//   - dry_run: true to only validate and report
+//
+// Rows with errors are skipped and reported; the remaining rows are inserted
+// in a single transaction. Duplicates of existing items, or of earlier rows,
+// are reported as warnings and skipped unless allow_duplicate is set.
+func ImportLearningItems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes+1<<20)
+	data, filename, err := readImportFile(r, maxImportBytes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxImportBytes {
+		http.Error(w, "import file is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	languageID, err := strconv.Atoi(r.FormValue("language_id"))
+	if err != nil {
+		http.Error(w, "language_id parameter required", http.StatusBadRequest)
+		return
+	}
+	if !authorizeLanguage(w, userID, languageID) {
+		return
+	}
+
+	defaultType := r.FormValue("type")
+	if defaultType == "" {
+		defaultType = "word"
+	}
+	if !validItemTypes[defaultType] {
+		http.Error(w, "type must be one of word, sentence, grammar, letter", http.StatusBadRequest)
+		return
+	}
+
+	var mapping map[string]string
+	if v := r.FormValue("mapping"); v != "" {
+		if err := json.Unmarshal([]byte(v), &mapping); err != nil {
+			http.Error(w, "mapping must be a JSON object: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	if importFormat(r.FormValue("format"), filename, data) == "tsv" {
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	}
+
+	records, lines, err := readRecords(reader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var header []string
+	if r.FormValue("header") != "false" && len(records) > 0 {
+		header, records, lines = records[0], records[1:], lines[1:]
+	}
+	if len(records) > maxImportRows {
+		http.Error(w, "import files are limited to "+strconv.Itoa(maxImportRows)+" rows", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	columns, err := mapImportColumns(header, mapping)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batch, err := newImportBatch(r, userID, languageID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	batch.report.Rows = len(records)
+
+	var items []models.LearningItem
+	for i, record := range records {
+		item := models.LearningItem{UserID: userID, LanguageID: languageID}
+		for col, field := range columns {
+			if col < len(record) {
+				importFields[field](&item, strings.TrimSpace(record[col]))
+			}
+		}
+		if item.Type == "" {
+			item.Type = defaultType
+		}
+
+		if batch.accept(lines[i], &item) {
+			items = append(items, item)
+		}
+	}
+	batch.report.Imported = len(items)
+	batch.report.Skipped = batch.report.Rows - batch.report.Imported
+
+	if !batch.report.DryRun && len(items) > 0 {
+		tx, err := database.DB.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		for i := range items {
+			if err := insertLearningItem(tx, &items[i]); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			batch.report.ItemIDs = append(batch.report.ItemIDs, items[i].ID)
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch.report)
+}
+
+// importBatch validates the rows of one import and tracks the report.
+type importBatch struct {
+	report          models.ImportReport
+	code            string         // language code, for normalization
+	existing        map[string]int // content keys seen, to an item ID or 0 for earlier rows
+	allowDuplicates bool
+}
+
+// newImportBatch reads the dry_run and allow_duplicate options and loads
+// the content keys already used in the language.
+func newImportBatch(r *http.Request, userID, languageID int) (*importBatch, error) {
+	batch := &importBatch{
+		report: models.ImportReport{
+			DryRun:   r.FormValue("dry_run") == "true",
+			Errors:   []models.ImportIssue{},
+			Warnings: []models.ImportIssue{},
+		},
+		allowDuplicates: r.FormValue("allow_duplicate") == "true",
+	}
+	if err := database.DB.QueryRow("SELECT language_code FROM languages WHERE id = ?", languageID).Scan(&batch.code); err != nil {
+		return nil, err
+	}
+	var err error
+	batch.existing, err = existingContentKeys(userID, languageID)
+	return batch, err
+}
+
+// accept validates the item from row, reporting why it is skipped if it
+// is invalid or a duplicate.
+func (b *importBatch) accept(row int, item *models.LearningItem) bool {
+	if issue := validateImportItem(item); issue != nil {
+		issue.Row = row
+		b.report.Errors = append(b.report.Errors, *issue)
+		return false
+	}
+
+	key := normalize.Key(b.code, item.Content)
+	duplicateID, ok := b.existing[key]
+	if !ok {
+		b.existing[key] = 0
+		return true
+	}
+
+	issue := models.ImportIssue{Row: row, Field: "content", DuplicateID: duplicateID}
+	if duplicateID == 0 {
+		issue.Message = "Duplicates an earlier row"
+	} else {
+		issue.Message = "An item with the same content already exists in this language"
+	}
+	if !b.allowDuplicates {
+		issue.Message += "; skipped"
+	}
+	b.report.Warnings = append(b.report.Warnings, issue)
+	return b.allowDuplicates
+}
+
+// readImportFile returns the uploaded file of a multipart request, or the
+// request body otherwise, along with the file name if there is one.
+func readImportFile(r *http.Request, limit int64) ([]byte, string, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", errors.New("file is required: " + err.Error())
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, limit+1))
+		return data, header.Filename, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	return data, "", err
+}
+
+// importFormat picks csv or tsv from the format parameter, the file
+// extension, or failing those the first line of data.
+func importFormat(format, filename string, data []byte) string {
+	if format == "csv" || format == "tsv" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".tsv", ".tab":
+		return "tsv"
+	case ".csv":
+		return "csv"
+	}
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte("\t")) > bytes.Count(firstLine, []byte(",")) {
+		return "tsv"
+	}
+	return "csv"
+}
+
+// readRecords reads every record along with the line it starts on.
+func readRecords(reader *csv.Reader) ([][]string, []int, error) {
+	var records [][]string
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, lines, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+}
+
+// mapImportColumns resolves the mapping to item fields keyed by column
+// index. Without a mapping, header names matching field names are used.
+func mapImportColumns(header []string, mapping map[string]string) (map[int]string, error) {
+	columns := make(map[int]string)
+	if mapping == nil {
+		for i, name := range header {
+			field := strings.ToLower(strings.TrimSpace(name))
+			if _, ok := importFields[field]; ok {
+				columns[i] = field
+			}
+		}
+	}
+
+	for column, field := range mapping {
+		if _, ok := importFields[field]; !ok {
+			return nil, errors.New("mapping: unknown field \"" + field + "\"")
+		}
+		index := -1
+		for i, name := range header {
+			if strings.TrimSpace(name) == column {
+				index = i
+				break
+			}
+		}
+		if n, err := strconv.Atoi(column); index < 0 && err == nil && n >= 1 {
+			index = n - 1
+		}
+		if index < 0 {
+			return nil, errors.New("mapping: no column \"" + column + "\"")
+		}
+		columns[index] = field
+	}
+
+	for _, field := range columns {
+		if field == "content" {
+			return columns, nil
+		}
+	}
+	return nil, errors.New("no column is mapped to content")
+}
+
+// validateImportItem checks a row the way CreateLearningItem and
+// UpdateLearningItem check their input.
+func validateImportItem(item *models.LearningItem) *models.ImportIssue {
+	if item.Content == "" {
+		return &models.ImportIssue{Field: "content", Message: "content must not be empty"}
+	}
+	if !validItemTypes[item.Type] {
+		return &models.ImportIssue{Field: "type", Message: "type must be one of word, sentence, grammar, letter"}
+	}
+	tags, err := cleanTagNames(item.Tags)
+	if err != nil {
+		return &models.ImportIssue{Field: "tags", Message: err.Error()}
+	}
+	item.Tags = tags
+	return nil
+}
+
+// existingContentKeys maps the normalized content of the user's items in a
+// language to an item ID.
+func existingContentKeys(userID, languageID int) (map[string]int, error) {
+	rows, err := database.DB.Query(
+		"SELECT content_key, MIN(id) FROM learning_items WHERE user_id = ? AND language_id = ? AND content_key IS NOT NULL GROUP BY content_key",
+		userID, languageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]int)
+	for rows.Next() {
+		var key string
+		var id int
+		if err := rows.Scan(&key, &id); err != nil {
+			return nil, err
+		}
+		keys[key] = id
+	}
+	return keys, rows.Err()
+}
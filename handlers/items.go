@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"language-learner/database"
 	"language-learner/models"
+	"language-learner/normalize"
+	"language-learner/store"
 	"net/http"
-	"time"
+	"strconv"
+	"strings"
 )
 
 func CreateLearningItem(w http.ResponseWriter, r *http.Request) {
@@ -14,96 +19,197 @@ func CreateLearningItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Room for an inline recording of the maximum size, base64 encoded
+	r.Body = http.MaxBytesReader(w, r.Body, maxAudioBytes/3*4+1<<20)
 	var item models.LearningItem
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := `INSERT INTO learning_items 
-		(user_id, language_id, type, content, translation, meaning, pronunciation, example_usage, notes)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if !checkBodyUser(w, item.UserID, userID) || !authorizeLanguage(w, userID, item.LanguageID) {
+		return
+	}
+	item.UserID = userID
 
-	result, err := database.DB.Exec(query,
-		item.UserID, item.LanguageID, item.Type, item.Content,
-		item.Translation, item.Meaning, item.Pronunciation,
-		item.ExampleUsage, item.Notes)
+	tags, err := cleanTagNames(item.Tags)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	item.Tags = tags
+
+	// Older clients send the recording inline as a base64 data URL
+	var audio *models.ItemAudio
+	var audioData []byte
+	if item.AudioData != "" {
+		mimeType, data, err := decodeDataURL(item.AudioData)
+		if err == nil && len(data) > maxAudioBytes {
+			err = errors.New("audio_data is too large")
+		}
+		if err == nil {
+			if mimeType = audioMimeType(mimeType, data); mimeType == "" {
+				err = errors.New("audio_data is not a supported audio format")
+			}
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		audio, audioData = &models.ItemAudio{MimeType: mimeType}, data
+	}
+
+	// Refuse items whose content matches an existing one once normalized for
+	// the language, unless the client explicitly allows duplicates
+	if r.URL.Query().Get("allow_duplicate") != "true" {
+		duplicateID, err := findDuplicateItem(userID, item.LanguageID, item.Content)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if duplicateID != 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":        "An item with the same content already exists in this language",
+				"duplicate_id": duplicateID,
+			})
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := insertLearningItem(tx, &item); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	id, _ := result.LastInsertId()
-	item.ID = int(id)
+	if audio != nil {
+		audio.ItemID = item.ID
+		if err := database.Store.WithTx(tx).SaveItemAudio(audio, audioData); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		item.AudioData = ""
+		item.HasAudio = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(item)
 }
 
+// insertLearningItem inserts item with its tags inside tx, sets item.ID and
+// records the creation as the item's first revision.
+func insertLearningItem(tx *sql.Tx, item *models.LearningItem) error {
+	s := database.Store.WithTx(tx)
+	if err := s.CreateItem(item); err != nil {
+		return err
+	}
+	return s.AddRevision(item.ID, item.UserID, "create", diffItems(models.LearningItem{}, *item))
+}
+
+// findDuplicateItem returns the ID of the user's item in languageID whose
+// normalized content equals content's, or 0 if there is none.
+func findDuplicateItem(userID, languageID int, content string) (int, error) {
+	lang, err := database.Store.GetLanguage(languageID)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := database.Store.FindItemByKey(userID, languageID, normalize.Key(lang.LanguageCode, content))
+	if err == store.ErrNotFound {
+		return 0, nil
+	}
+	return id, err
+}
+
 func GetLearningItems(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID := r.URL.Query().Get("user_id")
-	languageID := r.URL.Query().Get("language_id")
-	dateFilter := r.URL.Query().Get("date_filter") // day, week, month, biweekly, all
-
-	query := `SELECT id, user_id, language_id, type, content, translation, meaning, 
-		pronunciation, example_usage, notes, created_at 
-		FROM learning_items WHERE user_id = ?`
-
-	args := []interface{}{userID}
-	if languageID != "" {
-		query += " AND language_id = ?"
-		args = append(args, languageID)
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
 	}
 
-	// Apply date filter
-	if dateFilter != "" && dateFilter != "all" {
-		var timeThreshold time.Time
-		now := time.Now()
-		switch dateFilter {
-		case "day":
-			timeThreshold = now.AddDate(0, 0, -1)
-		case "week":
-			timeThreshold = now.AddDate(0, 0, -7)
-		case "biweekly":
-			timeThreshold = now.AddDate(0, 0, -14)
-		case "month":
-			timeThreshold = now.AddDate(0, -1, 0)
+	filter := store.ItemFilter{UserID: userID}
+	if languageID := r.URL.Query().Get("language_id"); languageID != "" {
+		id, err := strconv.Atoi(languageID)
+		if err != nil {
+			http.Error(w, "invalid language_id", http.StatusBadRequest)
+			return
 		}
-		query += " AND created_at >= ?"
-		args = append(args, timeThreshold.Format(time.RFC3339))
+		filter.LanguageID = id
 	}
 
-	query += " ORDER BY created_at DESC"
+	tags, mode, err := parseTagParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Tags, filter.AnyTag = tags, mode == "or"
+
+	filter.Created, ok = createdRange(w, userID, r.URL.Query())
+	if !ok {
+		return
+	}
 
-	rows, err := database.DB.Query(query, args...)
+	items, err := database.Store.ListItems(filter)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var items []models.LearningItem
-	for rows.Next() {
-		var item models.LearningItem
-		var createdAt string
-		err := rows.Scan(&item.ID, &item.UserID, &item.LanguageID, &item.Type,
-			&item.Content, &item.Translation, &item.Meaning, &item.Pronunciation,
-			&item.ExampleUsage, &item.Notes, &createdAt)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		item.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		items = append(items, item)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func GetLearningItem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeItem(w, userID, id) {
+		return
+	}
+
+	item, err := database.Store.GetItem(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(items)
+	json.NewEncoder(w).Encode(item)
 }
 
 func DeleteLearningItem(w http.ResponseWriter, r *http.Request) {
@@ -112,14 +218,22 @@ func DeleteLearningItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "id parameter required", http.StatusBadRequest)
+	userID, ok := requireUser(w, r)
+	if !ok {
 		return
 	}
 
-	_, err := database.DB.Exec("DELETE FROM learning_items WHERE id = ?", id)
+	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeItem(w, userID, id) {
+		return
+	}
+
+	if err := database.Store.DeleteItem(id); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -127,3 +241,162 @@ func DeleteLearningItem(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// LearningItemUpdate holds the fields of a PUT/PATCH request. Nil fields are
+// left unchanged; a non-nil Tags replaces all of the item's tags.
+type LearningItemUpdate struct {
+	LanguageID    *int      `json:"language_id"`
+	Type          *string   `json:"type"`
+	Content       *string   `json:"content"`
+	Translation   *string   `json:"translation"`
+	Meaning       *string   `json:"meaning"`
+	Pronunciation *string   `json:"pronunciation"`
+	ExampleUsage  *string   `json:"example_usage"`
+	Notes         *string   `json:"notes"`
+	Tags          *[]string `json:"tags"`
+}
+
+var validItemTypes = map[string]bool{"word": true, "sentence": true, "grammar": true, "letter": true}
+
+func UpdateLearningItem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeItem(w, userID, id) {
+		return
+	}
+
+	var update LearningItemUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if update.Type != nil && !validItemTypes[*update.Type] {
+		http.Error(w, "type must be one of word, sentence, grammar, letter", http.StatusBadRequest)
+		return
+	}
+	if update.Content != nil && *update.Content == "" {
+		http.Error(w, "content must not be empty", http.StatusBadRequest)
+		return
+	}
+	if update.LanguageID != nil && !authorizeLanguage(w, userID, *update.LanguageID) {
+		return
+	}
+	if update.Tags != nil {
+		tags, err := cleanTagNames(*update.Tags)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		update.Tags = &tags
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	item, err := applyItemUpdate(tx, userID, id, update, "update")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// applyItemUpdate writes the supplied fields of update to the item, records
+// the change as a revision by authorID, and returns the updated item.
+func applyItemUpdate(tx *sql.Tx, authorID, id int, update LearningItemUpdate, action string) (models.LearningItem, error) {
+	before, err := database.Store.WithTx(tx).GetItem(id)
+	if err != nil {
+		return before, err
+	}
+
+	var sets []string
+	var args []interface{}
+	for _, f := range []struct {
+		column string
+		value  interface{}
+		set    bool
+	}{
+		{"language_id", update.LanguageID, update.LanguageID != nil},
+		{"type", update.Type, update.Type != nil},
+		{"content", update.Content, update.Content != nil},
+		{"translation", update.Translation, update.Translation != nil},
+		{"meaning", update.Meaning, update.Meaning != nil},
+		{"pronunciation", update.Pronunciation, update.Pronunciation != nil},
+		{"example_usage", update.ExampleUsage, update.ExampleUsage != nil},
+		{"notes", update.Notes, update.Notes != nil},
+	} {
+		if f.set {
+			sets = append(sets, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	if update.Tags != nil {
+		if err := database.Store.WithTx(tx).SetItemTags(before.UserID, id, *update.Tags); err != nil {
+			return before, err
+		}
+	}
+	if len(sets) == 0 {
+		return database.Store.WithTx(tx).GetItem(id)
+	}
+
+	args = append(args, id)
+	if _, err := tx.Exec("UPDATE learning_items SET "+strings.Join(sets, ", ")+" WHERE id = ?", args...); err != nil {
+		return before, err
+	}
+
+	// Keep the review history filed under the item's language, and take the
+	// item out of decks for its old one
+	if update.LanguageID != nil {
+		if _, err := tx.Exec("UPDATE flashcard_sessions SET language_id = ? WHERE item_id = ?", *update.LanguageID, id); err != nil {
+			return before, err
+		}
+		if err := removeFromOtherLanguageDecks(tx, id, *update.LanguageID); err != nil {
+			return before, err
+		}
+	}
+
+	if err := database.UpdateNormalizedText(tx, id); err != nil {
+		return before, err
+	}
+
+	after, err := database.Store.WithTx(tx).GetItem(id)
+	if err != nil {
+		return after, err
+	}
+	if changes := diffItems(before, after); len(changes) > 0 {
+		if err := recordRevision(tx, id, authorID, action, changes); err != nil {
+			return after, err
+		}
+	}
+	return after, nil
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCreateLearningItemInlineAudio(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		f := newReviewFixture(t)
+		ctx := context.WithValue(context.Background(), userIDKey, f.userID)
+		dataURL := func(mimeType string, data []byte) string {
+			return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+		}
+
+		tests := []struct {
+			name, content, audio string
+			want                 int
+		}{
+			{"html", "uno", dataURL("text/html", []byte("<script>alert(1)</script>")), http.StatusBadRequest},
+			{"too large", "dos", dataURL("audio/mpeg", make([]byte, maxAudioBytes+1)), http.StatusBadRequest},
+			{"not a data URL", "tres", "https://example.com/a.mp3", http.StatusBadRequest},
+			{"recording", "cuatro", dataURL("audio/mpeg", []byte("ID3 recording")), http.StatusOK},
+		}
+		for _, tt := range tests {
+			body, _ := json.Marshal(map[string]interface{}{
+				"language_id": f.languageID, "type": "word", "content": tt.content, "audio_data": tt.audio,
+			})
+			w := httptest.NewRecorder()
+			CreateLearningItem(w, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(string(body))).WithContext(ctx))
+			if w.Code != tt.want {
+				t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+				continue
+			}
+			if tt.want != http.StatusOK {
+				continue
+			}
+
+			var item struct{ ID int }
+			json.NewDecoder(w.Body).Decode(&item)
+			r := httptest.NewRequest(http.MethodGet, "/items/"+strconv.Itoa(item.ID)+"/audio", nil).WithContext(ctx)
+			r.SetPathValue("id", strconv.Itoa(item.ID))
+			w = httptest.NewRecorder()
+			GetItemAudio(w, r)
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "audio/mpeg" ||
+				w.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Errorf("GetItemAudio = %d %v", w.Code, w.Header())
+			}
+		}
+	})
+}
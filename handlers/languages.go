@@ -1,109 +1,329 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"language-learner/database"
+	"language-learner/iso639"
 	"language-learner/models"
+	"language-learner/store"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
+// canonicalizeLanguage checks lang's code against the ISO 639 catalog and
+// replaces it with the canonical form, so "ES" and "spa" both become "es".
+// The script and direction come from the catalog, as does the name when
+// lang has none.
+func canonicalizeLanguage(lang *models.Language) bool {
+	entry, ok := iso639.Lookup(lang.LanguageCode)
+	if !ok {
+		return false
+	}
+	lang.LanguageCode = entry.Code
+	lang.LanguageName = strings.TrimSpace(lang.LanguageName)
+	if lang.LanguageName == "" {
+		lang.LanguageName = entry.Name
+	}
+	lang.Script, lang.Direction = entry.Script, entry.Direction
+	return true
+}
+
+func unknownLanguageCode(w http.ResponseWriter, code string) {
+	http.Error(w, "unknown language code \""+strings.TrimSpace(code)+"\"; see /languages/catalog", http.StatusBadRequest)
+}
+
+// LanguageUpdate holds the fields of a PUT/PATCH request; nil fields are
+// left unchanged.
+type LanguageUpdate struct {
+	LanguageCode *string `json:"language_code"`
+	LanguageName *string `json:"language_name"`
+}
+
 func CreateLanguage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	var lang models.Language
 	if err := json.NewDecoder(r.Body).Decode(&lang); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Validate required fields
-	if lang.UserID == 0 || lang.LanguageCode == "" || lang.LanguageName == "" {
-		http.Error(w, "user_id, language_code, and language_name are required", http.StatusBadRequest)
+	if !checkBodyUser(w, lang.UserID, userID) {
 		return
 	}
+	lang.UserID = userID
 
-	// Check if language already exists for this user
-	var existingID int
-	checkQuery := `SELECT id FROM languages WHERE user_id = ? AND language_code = ?`
-	err := database.DB.QueryRow(checkQuery, lang.UserID, lang.LanguageCode).Scan(&existingID)
-	if err == nil {
-		// Language already exists
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Language with code \"" + lang.LanguageCode + "\" already exists for this user",
-		})
+	// Validate required fields; the name defaults to the catalog's
+	if lang.LanguageCode == "" {
+		http.Error(w, "language_code is required", http.StatusBadRequest)
+		return
+	}
+	if !canonicalizeLanguage(&lang) {
+		unknownLanguageCode(w, lang.LanguageCode)
 		return
 	}
 
-	query := `INSERT INTO languages (user_id, language_code, language_name)
-		VALUES (?, ?, ?)`
+	err := database.Store.CreateLanguage(&lang)
+	if err == store.ErrConflict {
+		writeError(w, http.StatusConflict, "Language with code \""+lang.LanguageCode+"\" already exists for this user")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lang)
+}
+
+func GetLanguages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	result, err := database.DB.Exec(query, lang.UserID, lang.LanguageCode, lang.LanguageName)
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	languages, err := database.Store.ListLanguages(userID)
 	if err != nil {
-		// Check if it's a unique constraint violation
-		if err.Error() != "" && (err.Error() == "UNIQUE constraint failed: languages.user_id, languages.language_code" ||
-			err.Error() == "UNIQUE constraint failed: languages.user_id, languages.language_code") {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusConflict)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": "Language with code \"" + lang.LanguageCode + "\" already exists for this user",
-			})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(languages)
+}
+
+// UpdateLanguage renames a language or changes its code. Items are
+// normalized by language code, so a new code recomputes their duplicate
+// keys and search text.
+func UpdateLanguage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid language id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeLanguage(w, userID, id) {
+		return
+	}
+
+	var update LanguageUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if update.LanguageName != nil {
+		name := strings.TrimSpace(*update.LanguageName)
+		if name == "" {
+			http.Error(w, "language_name must not be empty", http.StatusBadRequest)
+			return
+		}
+		if _, err := tx.Exec("UPDATE languages SET language_name = ? WHERE id = ?", name, id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+	}
+
+	if update.LanguageCode != nil {
+		entry, ok := iso639.Lookup(*update.LanguageCode)
+		if !ok {
+			unknownLanguageCode(w, *update.LanguageCode)
+			return
+		}
+		code := entry.Code
+		existing, err := database.Store.WithTx(tx).FindLanguage(userID, code)
+		if err == nil && existing.ID != id {
+			writeError(w, http.StatusConflict, "Language with code \""+code+"\" already exists for this user")
+			return
+		}
+		if err != nil && err != store.ErrNotFound {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec("UPDATE languages SET language_code = ?, script = ?, direction = ? WHERE id = ?",
+			code, entry.Script, entry.Direction, id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := renormalizeLanguage(tx, id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	lang, err := database.Store.WithTx(tx).GetLanguage(id)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil || id == 0 {
-		http.Error(w, "Failed to insert language", http.StatusInternalServerError)
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	lang.ID = int(id)
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(lang)
 }
 
-func GetLanguages(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+func renormalizeLanguage(tx *sql.Tx, languageID int) error {
+	rows, err := tx.Query("SELECT id FROM learning_items WHERE language_id = ?", languageID)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := database.UpdateNormalizedText(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// languageDeletes remove a language's items and everything attached to
+// them, children before parents. Each takes the language ID.
+var languageDeletes = func() []string {
+	var deletes []string
+	for _, table := range store.ItemDependentTables {
+		deletes = append(deletes, "DELETE FROM "+table+" WHERE item_id IN (SELECT id FROM learning_items WHERE language_id = ?)")
+	}
+	return append(deletes,
+		"DELETE FROM learning_items WHERE language_id = ?",
+	)
+}()
+
+// DeleteLanguage removes a language and its decks. A language that still
+// has items is only deleted with cascade=true, which removes the items with
+// their sessions, audio, card state and history too.
+func DeleteLanguage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, "user_id parameter required", http.StatusBadRequest)
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid language id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeLanguage(w, userID, id) {
 		return
 	}
+	cascade := r.URL.Query().Get("cascade") == "true"
 
-	rows, err := database.DB.Query(
-		"SELECT id, user_id, language_code, language_name, created_at FROM languages WHERE user_id = ?",
-		userID)
+	tx, err := database.DB.Begin()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var languages []models.Language
-	for rows.Next() {
-		var lang models.Language
-		var createdAt string
-		err := rows.Scan(&lang.ID, &lang.UserID, &lang.LanguageCode, &lang.LanguageName, &createdAt)
-		if err != nil {
+	var itemCount int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM learning_items WHERE language_id = ?", id).Scan(&itemCount); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if itemCount > 0 && !cascade {
+		writeError(w, http.StatusConflict,
+			"Language has "+strconv.Itoa(itemCount)+" items; pass cascade=true to delete them too")
+		return
+	}
+
+	deletes := []string{
+		"DELETE FROM deck_items WHERE deck_id IN (SELECT id FROM decks WHERE language_id = ?)",
+		"DELETE FROM decks WHERE language_id = ?",
+	}
+	if cascade {
+		deletes = append(deletes, languageDeletes...)
+	}
+	// Sessions are filed under the language too
+	deletes = append(deletes,
+		"DELETE FROM flashcard_sessions WHERE language_id = ?",
+		"DELETE FROM languages WHERE id = ?",
+	)
+	for _, query := range deletes {
+		if _, err := tx.Exec(query, id); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		languages = append(languages, lang)
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetLanguageCatalog lists the ISO 639 languages that can be created. An
+// optional q narrows it to languages whose code or English or native name
+// contains q.
+func GetLanguageCatalog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	languages := []iso639.Language{}
+	for _, lang := range iso639.All() {
+		if q == "" || lang.Code == q || lang.ISO6393 == q ||
+			strings.Contains(strings.ToLower(lang.Name), q) || strings.Contains(strings.ToLower(lang.NativeName), q) {
+			languages = append(languages, lang)
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(languages)
 }
-
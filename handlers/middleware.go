@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"language-learner/database"
+	"language-learner/store"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type contextKey string
+
+const userIDKey contextKey = "userId"
+
+// RequireAuth validates the Bearer token issued by HandleLogin and stores the
+// caller's user ID in the request context before calling next.
+func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		tokenString, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || tokenString == "" {
+			writeError(w, http.StatusUnauthorized, "Missing or malformed Authorization header")
+			return
+		}
+
+		userID, err := parseUserToken(tokenString)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+
+		// Tokens outlive deleted accounts
+		exists, err := userExists(userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDKey, userID)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// UserIDFromContext returns the authenticated user ID set by RequireAuth.
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDKey).(int)
+	return userID, ok
+}
+
+func parseUserToken(tokenString string) (int, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return 0, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, jwt.ErrTokenInvalidClaims
+	}
+	userID, ok := claims["userId"].(float64)
+	if !ok || userID <= 0 {
+		return 0, jwt.ErrTokenInvalidClaims
+	}
+	return int(userID), nil
+}
+
+// requireUser returns the authenticated user ID. A user_id query parameter is
+// still accepted for older clients, but it must match the token.
+func requireUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return 0, false
+	}
+
+	if param := r.URL.Query().Get("user_id"); param != "" && param != strconv.Itoa(userID) {
+		writeError(w, http.StatusForbidden, "Access denied")
+		return 0, false
+	}
+	return userID, true
+}
+
+// checkBodyUser rejects request bodies that name a different user than the
+// authenticated one. A zero ID means the client left it out.
+func checkBodyUser(w http.ResponseWriter, bodyUserID, userID int) bool {
+	if bodyUserID != 0 && bodyUserID != userID {
+		writeError(w, http.StatusForbidden, "Access denied")
+		return false
+	}
+	return true
+}
+
+// authorizeLanguage verifies that the language exists and belongs to userID.
+func authorizeLanguage(w http.ResponseWriter, userID, languageID int) bool {
+	lang, err := database.Store.GetLanguage(languageID)
+	return checkOwner(w, lang.UserID, err, userID, "Language not found")
+}
+
+// authorizeItem verifies that the learning item exists and belongs to userID.
+func authorizeItem(w http.ResponseWriter, userID, itemID int) bool {
+	item, err := database.Store.GetItem(itemID)
+	return checkOwner(w, item.UserID, err, userID, "Item not found")
+}
+
+// authorizeTag verifies that the tag exists and belongs to userID.
+func authorizeTag(w http.ResponseWriter, userID, tagID int) bool {
+	return authorizeOwner(w, "SELECT user_id FROM tags WHERE id = ?", tagID, userID, "Tag not found")
+}
+
+// authorizeDeck verifies that the deck exists and belongs to userID.
+func authorizeDeck(w http.ResponseWriter, userID, deckID int) bool {
+	return authorizeOwner(w, "SELECT user_id FROM decks WHERE id = ?", deckID, userID, "Deck not found")
+}
+
+func authorizeOwner(w http.ResponseWriter, query string, id, userID int, notFound string) bool {
+	var ownerID int
+	err := database.DB.QueryRow(query, id).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		err = store.ErrNotFound
+	}
+	return checkOwner(w, ownerID, err, userID, notFound)
+}
+
+// checkOwner writes the error response for a failed ownership lookup and
+// reports whether ownerID is userID.
+func checkOwner(w http.ResponseWriter, ownerID int, err error, userID int, notFound string) bool {
+	if err == store.ErrNotFound {
+		writeError(w, http.StatusNotFound, notFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if ownerID != userID {
+		writeError(w, http.StatusForbidden, "Access denied")
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
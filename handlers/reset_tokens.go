@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"language-learner/database"
+	"language-learner/dates"
+	"time"
+)
+
+// resetTokenTTL is how long a password reset token stays valid.
+const resetTokenTTL = 15 * time.Minute
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// issueResetToken creates a random reset token for userID and stores its
+// HMAC. The plain token is only ever returned to the caller.
+func issueResetToken(userID int) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().UTC().Add(resetTokenTTL)
+
+	_, err := database.DB.Exec(
+		"INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		userID, hashResetToken(token), dates.Format(expiresAt),
+	)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// consumeResetToken marks the token as used inside tx and returns its user.
+// Consuming is a single conditional UPDATE so two concurrent resets can't
+// both succeed with the same token.
+func consumeResetToken(tx *sql.Tx, token string) (int, error) {
+	hash := hashResetToken(token)
+	now := dates.Format(time.Now())
+
+	result, err := tx.Exec(
+		`UPDATE password_reset_tokens SET consumed_at = ?
+		WHERE token_hash = ? AND consumed_at IS NULL AND expires_at > ?`,
+		now, hash, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n != 1 {
+		return 0, errInvalidResetToken
+	}
+
+	var userID int
+	if err := tx.QueryRow("SELECT user_id FROM password_reset_tokens WHERE token_hash = ?", hash).Scan(&userID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// revokeResetTokens invalidates every outstanding reset token for userID.
+func revokeResetTokens(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(
+		"UPDATE password_reset_tokens SET consumed_at = ? WHERE user_id = ? AND consumed_at IS NULL",
+		dates.Format(time.Now()), userID,
+	)
+	return err
+}
+
+func hashResetToken(token string) string {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"language-learner/database"
+	"language-learner/models"
+	"net/http"
+	"strconv"
+)
+
+// itemFields returns the revisioned fields of item keyed by column name.
+func itemFields(item models.LearningItem) map[string]interface{} {
+	return map[string]interface{}{
+		"language_id":   item.LanguageID,
+		"type":          item.Type,
+		"content":       item.Content,
+		"translation":   item.Translation,
+		"meaning":       item.Meaning,
+		"pronunciation": item.Pronunciation,
+		"example_usage": item.ExampleUsage,
+		"notes":         item.Notes,
+	}
+}
+
+// diffItems returns the fields that differ between before and after. A zero
+// before item means after was just created, so every set field is reported
+// with a nil old value.
+func diffItems(before, after models.LearningItem) map[string]models.FieldChange {
+	created := before.ID == 0
+	old := itemFields(before)
+	changes := make(map[string]models.FieldChange)
+	for field, value := range itemFields(after) {
+		if created {
+			if value != "" {
+				changes[field] = models.FieldChange{New: value}
+			}
+		} else if old[field] != value {
+			changes[field] = models.FieldChange{Old: old[field], New: value}
+		}
+	}
+	return changes
+}
+
+// recordRevision appends the next revision of itemID inside tx.
+func recordRevision(tx *sql.Tx, itemID, authorID int, action string, changes map[string]models.FieldChange) error {
+	return database.Store.WithTx(tx).AddRevision(itemID, authorID, action, changes)
+}
+
+// loadRevisions returns the item's revisions newer than after, newest first.
+func loadRevisions(q querier, itemID, after int) ([]models.ItemRevision, error) {
+	rows, err := q.Query(
+		`SELECT id, item_id, revision, author_id, action, changes, created_at
+		FROM item_revisions WHERE item_id = ? AND revision > ? ORDER BY revision DESC`,
+		itemID, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.ItemRevision
+	for rows.Next() {
+		var rev models.ItemRevision
+		var changes string
+		if err := rows.Scan(&rev.ID, &rev.ItemID, &rev.Revision, &rev.AuthorID,
+			&rev.Action, &changes, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &rev.Changes); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// GetItemHistory lists an item's revisions, newest first.
+func GetItemHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeItem(w, userID, id) {
+		return
+	}
+
+	revisions, err := loadRevisions(database.DB, id, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// RestoreItemRevision rolls an item back to how it looked right after the
+// given revision. The rollback itself is recorded as a new revision.
+func RestoreItemRevision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	revision, err := strconv.Atoi(r.URL.Query().Get("revision"))
+	if err != nil || revision < 1 {
+		http.Error(w, "revision parameter required", http.StatusBadRequest)
+		return
+	}
+	if !authorizeItem(w, userID, id) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM item_revisions WHERE item_id = ? AND revision = ?)", id, revision).Scan(&exists)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	current, err := database.Store.WithTx(tx).GetItem(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Undo every later revision, newest first, starting from the current row
+	later, err := loadRevisions(tx, id, revision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	target := itemFields(current)
+	for _, rev := range later {
+		for field, change := range rev.Changes {
+			target[field] = change.Old
+		}
+	}
+
+	var update LearningItemUpdate
+	data, _ := json.Marshal(target)
+	if err := json.Unmarshal(data, &update); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if update.LanguageID != nil && *update.LanguageID != current.LanguageID &&
+		!authorizeLanguage(w, userID, *update.LanguageID) {
+		return
+	}
+
+	item, err := applyItemUpdate(tx, userID, id, update, "restore")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
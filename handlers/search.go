@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html"
+	"language-learner/database"
+	"language-learner/models"
+	"language-learner/normalize"
+	"language-learner/store"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// displayColumns are the FTS columns a snippet may be taken from, in order of
+// preference. The normalized search_text column is never shown.
+var displayColumns = [...]string{"content", "translation", "meaning", "notes", "example_usage"}
+
+// snippetColumns selects one snippet per display column. Matches are marked
+// with control characters rather than tags so the stored text can be
+// escaped before the marks become HTML, see highlightSnippet.
+var snippetColumns = func() string {
+	cols := make([]string, len(displayColumns))
+	for i := range displayColumns {
+		cols[i] = "snippet(learning_items_fts, " + strconv.Itoa(i) + ", char(2), char(3), '…', 12)"
+	}
+	return strings.Join(cols, ", ")
+}()
+
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+// highlightSnippet HTML-escapes a snippet and wraps its matches in <mark>.
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	return strings.NewReplacer(matchStart, "<mark>", matchEnd, "</mark>").Replace(snippet)
+}
+
+// SearchLearningItems runs a full-text search over the caller's items.
+// Every word in q must match, as a prefix, one of content, translation,
+// meaning, notes or example_usage, either as typed or after normalization
+// for the language (see package normalize). Results are ranked by bm25 with
+// matches in content weighted highest.
+func SearchLearningItems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if database.Postgres {
+		writeError(w, http.StatusNotImplemented, "Search is only supported on SQLite")
+		return
+	}
+	if !database.SearchEnabled {
+		writeError(w, http.StatusNotImplemented, "Search is not available: the server was built without SQLite FTS5")
+		return
+	}
+
+	params := r.URL.Query()
+	q := params.Get("q")
+	languageID := params.Get("language_id")
+
+	// Normalize the query the same way items are indexed, once per
+	// language it could apply to
+	var codes []string
+	codeQuery := "SELECT DISTINCT language_code FROM languages WHERE user_id = ?"
+	codeArgs := []interface{}{userID}
+	if languageID != "" {
+		codeQuery += " AND id = ?"
+		codeArgs = append(codeArgs, languageID)
+	}
+	rows, err := database.DB.Query(codeQuery, codeArgs...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		codes = append(codes, code)
+	}
+	rows.Close()
+
+	var terms []string
+	for _, variant := range append([]string{q}, normalize.Variants(q, codes...)...) {
+		if term := ftsQuery(variant); term != "" {
+			terms = append(terms, "("+term+")")
+		}
+	}
+	if len(terms) == 0 {
+		http.Error(w, "q parameter required", http.StatusBadRequest)
+		return
+	}
+	match := strings.Join(terms, " OR ")
+
+	limit, offset := defaultSearchLimit, 0
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+	if v := params.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	query := `SELECT li.id, li.user_id, li.language_id, li.type, li.content,
+		COALESCE(li.translation, ''), COALESCE(li.meaning, ''), COALESCE(li.pronunciation, ''),
+		COALESCE(li.example_usage, ''), COALESCE(li.notes, ''), li.created_at, ` + store.ItemHasAudio + `,
+		` + snippetColumns + `,
+		bm25(learning_items_fts, 10.0, 5.0, 3.0, 1.0, 2.0, 4.0) AS rank
+		FROM learning_items_fts
+		JOIN learning_items li ON li.id = learning_items_fts.rowid
+		WHERE learning_items_fts MATCH ? AND li.user_id = ?`
+	args := []interface{}{match, userID}
+
+	if languageID != "" {
+		query += " AND li.language_id = ?"
+		args = append(args, languageID)
+	}
+	if itemType := params.Get("type"); itemType != "" {
+		if !validItemTypes[itemType] {
+			http.Error(w, "type must be one of word, sentence, grammar, letter", http.StatusBadRequest)
+			return
+		}
+		query += " AND li.type = ?"
+		args = append(args, itemType)
+	}
+
+	query += " ORDER BY rank LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err = database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var res models.SearchResult
+		var snippets [len(displayColumns)]string
+		dest := []interface{}{&res.ID, &res.UserID, &res.LanguageID, &res.Type, &res.Content,
+			&res.Translation, &res.Meaning, &res.Pronunciation, &res.ExampleUsage, &res.Notes,
+			&res.CreatedAt, &res.HasAudio}
+		for i := range snippets {
+			dest = append(dest, &snippets[i])
+		}
+		if err := rows.Scan(append(dest, &res.Rank)...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Show the first field with a highlighted match. Items that only
+		// matched through their normalized text fall back to the content.
+		res.Snippet = highlightSnippet(snippets[0])
+		for _, snippet := range snippets {
+			if strings.Contains(snippet, matchStart) {
+				res.Snippet = highlightSnippet(snippet)
+				break
+			}
+		}
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// ftsQuery turns free text into an FTS5 query that requires every word as a
+// prefix match. Words are quoted so FTS5 operators in user input are taken
+// literally.
+func ftsQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	})
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import "testing"
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct{ snippet, want string }{
+		{"hola \x02mundo\x03", "hola <mark>mundo</mark>"},
+		{"<img src=x onerror=alert(1)> \x02zebra\x03", "&lt;img src=x onerror=alert(1)&gt; <mark>zebra</mark>"},
+		{"\x02Tom\x03 & \"Jerry\"…", "<mark>Tom</mark> &amp; &#34;Jerry&#34;…"},
+	}
+	for _, tt := range tests {
+		if got := highlightSnippet(tt.snippet); got != tt.want {
+			t.Errorf("highlightSnippet(%q) = %q, want %q", tt.snippet, got, tt.want)
+		}
+	}
+}
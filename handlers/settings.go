@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"language-learner/database"
+	"language-learner/dates"
+	"language-learner/models"
+	"net/http"
+	"net/url"
+	"time"
+	_ "time/tzdata" // serverless runtimes may not ship a zoneinfo database
+)
+
+var defaultSettings = models.UserSettings{
+	Timezone:       "UTC",
+	NewCardsPerDay: 20,
+	ReviewsPerDay:  200,
+}
+
+// loadUserSettings returns the user's settings, or the defaults if they have
+// never saved any.
+func loadUserSettings(userID int) (models.UserSettings, error) {
+	settings := defaultSettings
+	settings.UserID = userID
+
+	err := database.DB.QueryRow(
+		"SELECT timezone, new_cards_per_day, reviews_per_day FROM user_settings WHERE user_id = ?",
+		userID,
+	).Scan(&settings.Timezone, &settings.NewCardsPerDay, &settings.ReviewsPerDay)
+	if err != nil && err != sql.ErrNoRows {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// userLocation resolves the user's timezone, falling back to UTC if the
+// stored name is no longer known.
+func userLocation(settings models.UserSettings) *time.Location {
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// createdRange reads the date_filter, from and to query parameters, which
+// select learning items by when they were logged, in the user's timezone.
+func createdRange(w http.ResponseWriter, userID int, query url.Values) (dates.Range, bool) {
+	settings, err := loadUserSettings(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return dates.Range{}, false
+	}
+
+	created, err := dates.ParseRange(query.Get("date_filter"), query.Get("from"), query.Get("to"),
+		time.Now(), userLocation(settings))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return dates.Range{}, false
+	}
+	return created, true
+}
+
+func GetSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	settings, err := loadUserSettings(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Start from the current settings so omitted fields keep their values
+	settings, err := loadUserSettings(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkBodyUser(w, settings.UserID, userID) {
+		return
+	}
+	settings.UserID = userID
+
+	if _, err := time.LoadLocation(settings.Timezone); err != nil || settings.Timezone == "" {
+		http.Error(w, "timezone must be an IANA time zone name", http.StatusBadRequest)
+		return
+	}
+	if settings.NewCardsPerDay < 0 || settings.ReviewsPerDay < 0 {
+		http.Error(w, "daily limits must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	_, err = database.DB.Exec(
+		`INSERT INTO user_settings (user_id, timezone, new_cards_per_day, reviews_per_day, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			timezone = excluded.timezone, new_cards_per_day = excluded.new_cards_per_day,
+			reviews_per_day = excluded.reviews_per_day, updated_at = excluded.updated_at`,
+		settings.UserID, settings.Timezone, settings.NewCardsPerDay, settings.ReviewsPerDay, dates.Format(time.Now()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"language-learner/dates"
+	"language-learner/store"
+	"strings"
+	"time"
+)
+
+// maxPredicateDepth bounds how deeply all/any/not may nest.
+const maxPredicateDepth = 8
+
+// DeckPredicate is the saved filter of a smart deck. A node is either a
+// combinator (exactly one of All, Any or Not) or a comparison of Field
+// against Value using Op, e.g.
+//
+//	{"all": [
+//		{"field": "type", "op": "eq", "value": "word"},
+//		{"field": "accuracy", "op": "lt", "value": 60},
+//		{"field": "tag", "op": "eq", "value": "verbs"},
+//		{"field": "age_days", "op": "lte", "value": 30}
+//	]}
+type DeckPredicate struct {
+	All   []DeckPredicate `json:"all,omitempty"`
+	Any   []DeckPredicate `json:"any,omitempty"`
+	Not   *DeckPredicate  `json:"not,omitempty"`
+	Field string          `json:"field,omitempty"`
+	Op    string          `json:"op,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// numericFields map predicate fields to expressions over the item aliased
+// li and its card state cs. Items that were never reviewed have no accuracy
+// and match no comparison on it.
+var numericFields = map[string]string{
+	"review_count":  reviewCountSQL,
+	"correct_count": correctCountSQL,
+	"accuracy":      "(100.0 * " + correctCountSQL + " / NULLIF(" + reviewCountSQL + ", 0))",
+	"interval_days": "cs.interval_days",
+	"lapses":        "cs.lapses",
+}
+
+// ageFields map predicate fields counting days up to now to the timestamp
+// they count from. They compile to comparisons of the timestamp with a time
+// computed here, which both databases can do without date functions. Items
+// that were never reviewed have no days_since_review and match no
+// comparison on it.
+var ageFields = map[string]string{
+	"age_days":          "li.created_at",
+	"days_since_review": lastReviewedSQL,
+}
+
+// maxAgeDays bounds the days in age comparisons so the computed time stays
+// within the four-digit years of the storage format.
+const maxAgeDays = 100000
+
+var comparisonOps = map[string]string{
+	"eq": "=", "ne": "!=", "lt": "<", "lte": "<=", "gt": ">", "gte": ">=",
+}
+
+// reversedOps compare timestamps for ageFields: more days ago is earlier.
+var reversedOps = map[string]string{
+	"eq": "=", "ne": "!=", "lt": ">", "lte": ">=", "gt": "<", "gte": "<=",
+}
+
+// compilePredicate turns a predicate into a condition on the item aliased
+// li and its card state cs.
+func compilePredicate(p DeckPredicate) (string, []interface{}, error) {
+	return p.compile(0)
+}
+
+func (p DeckPredicate) compile(depth int) (string, []interface{}, error) {
+	if depth > maxPredicateDepth {
+		return "", nil, errors.New("predicate is nested too deeply")
+	}
+
+	kinds := 0
+	for _, set := range []bool{p.All != nil, p.Any != nil, p.Not != nil, p.Field != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return "", nil, errors.New("each predicate node needs exactly one of all, any, not or field")
+	}
+
+	switch {
+	case p.All != nil || p.Any != nil:
+		children, joiner, empty := p.All, " AND ", "TRUE"
+		if p.Any != nil {
+			children, joiner, empty = p.Any, " OR ", "FALSE"
+		}
+		if len(children) == 0 {
+			return empty, nil, nil
+		}
+		var parts []string
+		var args []interface{}
+		for _, child := range children {
+			sql, childArgs, err := child.compile(depth + 1)
+			if err != nil {
+				return "", nil, err
+			}
+			parts = append(parts, sql)
+			args = append(args, childArgs...)
+		}
+		return "(" + strings.Join(parts, joiner) + ")", args, nil
+
+	case p.Not != nil:
+		sql, args, err := p.Not.compile(depth + 1)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT COALESCE(" + sql + ", FALSE)", args, nil
+	}
+
+	return p.compileComparison()
+}
+
+func (p DeckPredicate) compileComparison() (string, []interface{}, error) {
+	if expr, ok := numericFields[p.Field]; ok {
+		op, value, err := p.number(comparisonOps)
+		if err != nil {
+			return "", nil, err
+		}
+		// Postgres would otherwise take the value for an integer when
+		// compared with a count
+		return expr + " " + op + " CAST(? AS DOUBLE PRECISION)", []interface{}{value}, nil
+	}
+	if column, ok := ageFields[p.Field]; ok {
+		op, days, err := p.number(reversedOps)
+		if err != nil {
+			return "", nil, err
+		}
+		days = min(max(days, -maxAgeDays), maxAgeDays)
+		since := time.Now().Add(-time.Duration(days * float64(24*time.Hour)))
+		return column + " " + op + " ?", []interface{}{dates.Format(since)}, nil
+	}
+
+	switch p.Field {
+	case "type":
+		values, err := p.stringValues()
+		if err != nil {
+			return "", nil, err
+		}
+		for _, v := range values {
+			if !validItemTypes[v] {
+				return "", nil, errors.New("type must be one of word, sentence, grammar, letter")
+			}
+		}
+		return p.membership("li.type IN ("+placeholders(len(values))+")", values)
+
+	case "tag":
+		values, err := p.stringValues()
+		if err != nil {
+			return "", nil, err
+		}
+		return p.membership(`EXISTS (SELECT 1 FROM item_tags it JOIN tags t ON t.id = it.tag_id
+			WHERE it.item_id = li.id AND LOWER(t.name) IN (`+lowerPlaceholders(len(values))+`))`, values)
+
+	case "has_audio":
+		var value bool
+		if p.Op != "eq" || json.Unmarshal(p.Value, &value) != nil {
+			return "", nil, errors.New("has_audio supports eq with true or false")
+		}
+		if value {
+			return store.ItemHasAudio, nil, nil
+		}
+		return "NOT " + store.ItemHasAudio, nil, nil
+	}
+
+	return "", nil, fmt.Errorf("unknown predicate field %q", p.Field)
+}
+
+// number decodes the number a numeric field is compared with and looks up
+// the operator in ops.
+func (p DeckPredicate) number(ops map[string]string) (string, float64, error) {
+	op, ok := ops[p.Op]
+	if !ok {
+		return "", 0, fmt.Errorf("%s supports eq, ne, lt, lte, gt and gte", p.Field)
+	}
+	var value float64
+	if err := json.Unmarshal(p.Value, &value); err != nil {
+		return "", 0, fmt.Errorf("%s must be compared with a number", p.Field)
+	}
+	return op, value, nil
+}
+
+// stringValues decodes a single string for eq/ne or a list for in.
+func (p DeckPredicate) stringValues() ([]string, error) {
+	switch p.Op {
+	case "eq", "ne":
+		var value string
+		if err := json.Unmarshal(p.Value, &value); err != nil {
+			return nil, fmt.Errorf("%s %s needs a string value", p.Field, p.Op)
+		}
+		return []string{value}, nil
+	case "in":
+		var values []string
+		if err := json.Unmarshal(p.Value, &values); err != nil || len(values) == 0 {
+			return nil, fmt.Errorf("%s in needs a non-empty list of strings", p.Field)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%s supports eq, ne and in", p.Field)
+}
+
+// membership negates a set-membership condition for ne.
+func (p DeckPredicate) membership(cond string, values []string) (string, []interface{}, error) {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	if p.Op == "ne" {
+		cond = "NOT " + cond
+	}
+	return cond, args, nil
+}
+
+// parsePredicate decodes and validates a stored or submitted predicate.
+func parsePredicate(data []byte) (string, []interface{}, error) {
+	var p DeckPredicate
+	if err := json.Unmarshal(data, &p); err != nil {
+		return "", nil, errors.New("predicate is not valid JSON: " + err.Error())
+	}
+	return compilePredicate(p)
+}
+
+// smartDeckItems is a subquery selecting the IDs of the items in the user's
+// language that currently match a smart deck's predicate.
+func smartDeckItems(userID, languageID int, predicate []byte) (string, []interface{}, error) {
+	cond, condArgs, err := parsePredicate(predicate)
+	if err != nil {
+		return "", nil, err
+	}
+	query := `SELECT li.id FROM learning_items li LEFT JOIN card_states cs ON cs.item_id = li.id
+		WHERE li.user_id = ? AND li.language_id = ? AND (` + cond + ")"
+	return query, append([]interface{}{userID, languageID}, condArgs...), nil
+}
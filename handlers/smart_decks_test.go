@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"language-learner/database"
+	"language-learner/dates"
+	"language-learner/models"
+	"language-learner/store"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// forEachDatabase runs test against a migrated SQLite database, and against
+// Postgres when TEST_POSTGRES_URL points at a disposable database whose
+// public schema may be dropped.
+func forEachDatabase(t *testing.T, test func(t *testing.T)) {
+	t.Run("sqlite", func(t *testing.T) {
+		t.Setenv("DATABASE_URL", "sqlite:"+filepath.Join(t.TempDir(), "test.db"))
+		openDatabase(t)
+		test(t)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv("TEST_POSTGRES_URL")
+		if url == "" {
+			t.Skip("TEST_POSTGRES_URL not set")
+		}
+		t.Setenv("DATABASE_URL", url)
+		openDatabase(t)
+		test(t)
+	})
+}
+
+func openDatabase(t *testing.T) {
+	t.Helper()
+	if err := database.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.CloseDB() })
+	if database.Postgres {
+		if _, err := database.DB.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := database.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reviewFixture is a user's Spanish items: hola, logged 40 days ago and
+// reviewed three times, last 10 days ago, with one miss; gato, logged 5 days
+// ago and missed yesterday; and adiós, logged today and never reviewed.
+type reviewFixture struct {
+	userID, languageID int
+	hola, gato, adios  int
+}
+
+func newReviewFixture(t *testing.T) reviewFixture {
+	t.Helper()
+	account := store.Account{PasswordHash: "hash", ForgotQuestion: "q", ForgotAnswerHash: "a"}
+	account.Username = "ana"
+	if err := database.Store.CreateUser(&account); err != nil {
+		t.Fatal(err)
+	}
+	lang := models.Language{UserID: account.ID, LanguageCode: "es", LanguageName: "Spanish"}
+	if err := database.Store.CreateLanguage(&lang); err != nil {
+		t.Fatal(err)
+	}
+	f := reviewFixture{userID: account.ID, languageID: lang.ID}
+
+	now := time.Now()
+	day := 24 * time.Hour
+	addItem := func(content string, age time.Duration, tags ...string) int {
+		item := models.LearningItem{UserID: f.userID, LanguageID: f.languageID, Type: "word", Content: content, Tags: tags}
+		if err := database.Store.CreateItem(&item); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.DB.Exec("UPDATE learning_items SET created_at = ? WHERE id = ?", dates.Format(now.Add(-age)), item.ID); err != nil {
+			t.Fatal(err)
+		}
+		return item.ID
+	}
+	review := func(itemID int, ago time.Duration, correct bool) {
+		session := models.FlashcardSession{UserID: f.userID, LanguageID: f.languageID, ItemID: itemID,
+			WasCorrect: correct, ShownAt: now.Add(-ago)}
+		if err := database.Store.CreateSession(&session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f.hola = addItem("hola", 40*day, "Greeting")
+	f.gato = addItem("gato", 5*day, "animals")
+	f.adios = addItem("adiós", 0, "greeting")
+	review(f.hola, 30*day, true)
+	review(f.hola, 20*day, false)
+	review(f.hola, 10*day, true)
+	review(f.gato, day, false)
+	return f
+}
+
+func TestQueryFlashcards(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		f := newReviewFixture(t)
+
+		cards, err := queryFlashcards(" WHERE li.user_id = ? ORDER BY li.id", f.userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		type stats struct {
+			content          string
+			reviews, correct int
+			reviewed         bool
+			tags             []string
+		}
+		var got []stats
+		for _, c := range cards {
+			got = append(got, stats{c.Content, c.ReviewCount, c.CorrectCount, c.LastReviewed != nil, c.Tags})
+		}
+		want := []stats{
+			{"hola", 3, 2, true, []string{"Greeting"}},
+			{"gato", 1, 0, true, []string{"animals"}},
+			{"adiós", 0, 0, false, []string{"Greeting"}},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("queryFlashcards = %+v, want %+v", got, want)
+		}
+	})
+}
+
+func TestSmartDeckItems(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		f := newReviewFixture(t)
+		names := map[int]string{f.hola: "hola", f.gato: "gato", f.adios: "adiós"}
+
+		tests := []struct {
+			predicate string
+			want      []string
+		}{
+			{`{"all": []}`, []string{"hola", "gato", "adiós"}},
+			{`{"any": []}`, []string{}},
+			{`{"field": "review_count", "op": "gte", "value": 1}`, []string{"hola", "gato"}},
+			{`{"field": "review_count", "op": "lt", "value": 1.5}`, []string{"gato", "adiós"}},
+			{`{"field": "accuracy", "op": "gt", "value": 50}`, []string{"hola"}},
+			{`{"not": {"field": "accuracy", "op": "gt", "value": 50}}`, []string{"gato", "adiós"}},
+			{`{"field": "age_days", "op": "gt", "value": 30}`, []string{"hola"}},
+			{`{"field": "age_days", "op": "lte", "value": 7}`, []string{"gato", "adiós"}},
+			{`{"field": "days_since_review", "op": "lt", "value": 2}`, []string{"gato"}},
+			{`{"field": "tag", "op": "eq", "value": "GREETING"}`, []string{"hola", "adiós"}},
+			{`{"all": [{"field": "tag", "op": "ne", "value": "animals"}, {"field": "type", "op": "eq", "value": "word"}]}`, []string{"hola", "adiós"}},
+			{`{"field": "has_audio", "op": "eq", "value": false}`, []string{"hola", "gato", "adiós"}},
+		}
+		for _, tt := range tests {
+			query, args, err := smartDeckItems(f.userID, f.languageID, []byte(tt.predicate))
+			if err != nil {
+				t.Errorf("%s: %v", tt.predicate, err)
+				continue
+			}
+			rows, err := database.DB.Query(query+" ORDER BY li.id", args...)
+			if err != nil {
+				t.Errorf("%s: %v", tt.predicate, err)
+				continue
+			}
+			got := []string{}
+			for rows.Next() {
+				var id int
+				if err := rows.Scan(&id); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, names[id])
+			}
+			rows.Close()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s matched %v, want %v", tt.predicate, got, tt.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"language-learner/database"
+	"language-learner/models"
+	"language-learner/store"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const maxTagLength = 64
+
+// itemTagsJSON is a SELECT expression returning the names of the tags on
+// the item aliased li as a JSON array.
+func itemTagsJSON() string {
+	return store.TagsJSON(database.Postgres)
+}
+
+func decodeTags(data string) []string {
+	var tags []string
+	json.Unmarshal([]byte(data), &tags)
+	return tags
+}
+
+// cleanTagNames trims names and drops case-insensitive duplicates.
+func cleanTagNames(names []string) ([]string, error) {
+	seen := map[string]bool{}
+	var cleaned []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if err := validateTagName(name); err != nil {
+			return nil, err
+		}
+		if key := strings.ToLower(name); !seen[key] {
+			seen[key] = true
+			cleaned = append(cleaned, name)
+		}
+	}
+	return cleaned, nil
+}
+
+func validateTagName(name string) error {
+	if name == "" {
+		return errors.New("tag names must not be empty")
+	}
+	if len(name) > maxTagLength {
+		return errors.New("tag names must be at most 64 bytes")
+	}
+	// Commas separate names in the tags= filter
+	if strings.Contains(name, ",") {
+		return errors.New("tag names must not contain commas")
+	}
+	return nil
+}
+
+// tagFilter builds a condition on li.id from the tags= parameters.
+func tagFilter(userID int, params url.Values) (string, []interface{}, error) {
+	names, mode, err := parseTagParams(params)
+	if err != nil || len(names) == 0 {
+		return "", nil, err
+	}
+
+	clause := ` AND li.id IN (SELECT it.item_id FROM item_tags it JOIN tags t ON t.id = it.tag_id
+		WHERE t.user_id = ? AND LOWER(t.name) IN (` + lowerPlaceholders(len(names)) + `) GROUP BY it.item_id`
+	args := []interface{}{userID}
+	for _, name := range names {
+		args = append(args, name)
+	}
+	if mode != "or" {
+		clause += " HAVING COUNT(DISTINCT t.id) = ?"
+		args = append(args, len(names))
+	}
+	return clause + ")", args, nil
+}
+
+// parseTagParams returns the tag names of the tags= parameters, which may
+// be repeated or comma-separated, and the tag_mode: or matches items with
+// any of the tags; the default, and, requires all of them.
+func parseTagParams(params url.Values) ([]string, string, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, value := range params["tags"] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if key := strings.ToLower(name); name != "" && !seen[key] {
+				seen[key] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, "", nil
+	}
+
+	mode := params.Get("tag_mode")
+	if mode != "" && mode != "and" && mode != "or" {
+		return nil, "", errors.New("tag_mode must be and or or")
+	}
+	return names, mode, nil
+}
+
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := database.DB.Query(
+		`SELECT t.id, t.user_id, t.name, t.created_at, COUNT(it.item_id)
+		FROM tags t LEFT JOIN item_tags it ON it.tag_id = t.id
+		WHERE t.user_id = ? GROUP BY t.id ORDER BY t.name`,
+		userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.CreatedAt, &tag.ItemCount); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+func CreateTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var tag models.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkBodyUser(w, tag.UserID, userID) {
+		return
+	}
+	tag.UserID = userID
+	tag.Name = strings.TrimSpace(tag.Name)
+	if err := validateTagName(tag.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Names are unique per user in any case
+	var exists bool
+	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM tags WHERE user_id = ? AND LOWER(name) = LOWER(?))", tag.UserID, tag.Name).Scan(&exists)
+	if err == nil && !exists {
+		err = database.DB.QueryRow("INSERT INTO tags (user_id, name) VALUES (?, ?) ON CONFLICT DO NOTHING RETURNING id", tag.UserID, tag.Name).Scan(&tag.ID)
+	}
+	if exists || err == sql.ErrNoRows {
+		writeError(w, http.StatusConflict, "Tag \""+tag.Name+"\" already exists")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// UpdateTag renames a tag.
+func UpdateTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid tag id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeTag(w, userID, id) {
+		return
+	}
+
+	var tag models.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tag.Name = strings.TrimSpace(tag.Name)
+	if err := validateTagName(tag.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var conflictID int
+	err = database.DB.QueryRow("SELECT id FROM tags WHERE user_id = ? AND LOWER(name) = LOWER(?) AND id != ?", userID, tag.Name, id).Scan(&conflictID)
+	if err == nil {
+		writeError(w, http.StatusConflict, "Tag \""+tag.Name+"\" already exists")
+		return
+	}
+	if err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := database.DB.Exec("UPDATE tags SET name = ? WHERE id = ?", tag.Name, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = database.DB.QueryRow(
+		`SELECT t.id, t.user_id, t.name, t.created_at, COUNT(it.item_id)
+		FROM tags t LEFT JOIN item_tags it ON it.tag_id = t.id WHERE t.id = ? GROUP BY t.id`, id,
+	).Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.CreatedAt, &tag.ItemCount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// DeleteTag removes a tag and its assignments; the items themselves stay.
+func DeleteTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid tag id", http.StatusBadRequest)
+		return
+	}
+	if !authorizeTag(w, userID, id) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM item_tags WHERE tag_id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,125 @@
+//go:build ignore
+
+// This program generates catalog.tsv from the language data in
+// golang.org/x/text, keeping every ISO 639 language that has an English
+// name. That is CLDR's subset of ISO 639, not the full ISO 639-3 table.
+// Run it with go generate.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// scriptOverrides replaces the script guessed from CLDR's likely subtags,
+// which for rarer languages is often low-confidence: a learner of Ancient
+// Greek reads the Greek alphabet, not the Cypriot syllabary the data picks,
+// and the writing direction follows from the script. An empty value leaves
+// the script unset.
+var scriptOverrides = map[string]string{
+	// Guessed wrong
+	"grc": "Grek",
+	"non": "Latn",
+	"sat": "Olck",
+	"sga": "Latn",
+	// Guessed as Zzzz, the code for an unknown script
+	"an":  "Latn",
+	"ars": "Arab",
+	"bh":  "Deva",
+	"ie":  "Latn",
+	"oj":  "Cans",
+	"ojg": "Latn",
+	"pi":  "",
+	"tw":  "Latn",
+	"mul": "",
+	"zxx": "",
+	// No guess, but written in one script
+	"ang": "Latn",
+	"avk": "Latn",
+	"chg": "Arab",
+	"dum": "Latn",
+	"elx": "Xsux",
+	"enm": "Latn",
+	"frm": "Latn",
+	"fro": "Latn",
+	"gmh": "Latn",
+	"goh": "Latn",
+	"hit": "Xsux",
+	"lfn": "Latn",
+	"mga": "Latn",
+	"nov": "Latn",
+	"pro": "Latn",
+	"sam": "Samr",
+	"sux": "Xsux",
+	"syc": "Syrc",
+	"tlh": "Latn",
+}
+
+func main() {
+	english := display.English.Languages()
+	bases := make(map[string]language.Base)
+
+	letters := "abcdefghijklmnopqrstuvwxyz"
+	var codes []string
+	for _, a := range letters {
+		for _, b := range letters {
+			codes = append(codes, string(a)+string(b))
+			for _, c := range letters {
+				codes = append(codes, string(a)+string(b)+string(c))
+			}
+		}
+	}
+	for _, code := range codes {
+		base, err := language.ParseBase(code)
+		if err != nil || (base.String() != code && base.ISO3() != code) {
+			continue
+		}
+		// Skip deprecated codes, which canonicalize to another language
+		if canonical, _ := language.Make(base.String()).Base(); canonical != base {
+			continue
+		}
+		if english.Name(base) == "" {
+			continue
+		}
+		bases[base.String()] = base
+	}
+
+	keys := make([]string, 0, len(bases))
+	for code := range bases {
+		keys = append(keys, code)
+	}
+	sort.Strings(keys)
+
+	f, err := os.Create("catalog.tsv")
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# Code generated by gen.go; DO NOT EDIT.")
+	fmt.Fprintln(w, "# code\tiso639_3\tname\tnative_name\tscript")
+	for _, code := range keys {
+		base := bases[code]
+		tag := language.Make(code)
+		script, confidence := tag.Script()
+		scriptCode := script.String()
+		if confidence == language.No {
+			scriptCode = ""
+		}
+		if override, ok := scriptOverrides[code]; ok {
+			scriptCode = override
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", code, base.ISO3(), english.Name(base), display.Self.Name(tag), scriptCode)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
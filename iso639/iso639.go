@@ -0,0 +1,112 @@
+// Package iso639 is a catalog of ISO 639 languages with the script they
+// are usually written in. Codes are canonicalized the way BCP 47 does: the
+// ISO 639-1 code when a language has one, otherwise its ISO 639-3 code.
+//
+// The catalog holds the languages CLDR has English names for, about 650 of
+// the nearly 8,000 in ISO 639-3, so rarer codes such as tok (Toki Pona)
+// are not found.
+package iso639
+
+//go:generate go run gen.go
+
+import (
+	_ "embed"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Language is a catalog entry. Script is an ISO 15924 code and Direction
+// is "ltr" or "rtl".
+type Language struct {
+	Code       string `json:"code"`
+	ISO6391    string `json:"iso639_1,omitempty"`
+	ISO6393    string `json:"iso639_3"`
+	Name       string `json:"name"`
+	NativeName string `json:"native_name,omitempty"`
+	Script     string `json:"script,omitempty"`
+	Direction  string `json:"direction"`
+}
+
+//go:embed catalog.tsv
+var catalogTSV string
+
+var (
+	catalog []Language
+	byCode  = make(map[string]int) // ISO 639-1 and 639-3 codes to catalog index
+)
+
+// rtlScripts are the ISO 15924 scripts written right to left.
+var rtlScripts = map[string]bool{
+	"Adlm": true, "Arab": true, "Aran": true, "Armi": true, "Avst": true, "Cprt": true, "Hebr": true,
+	"Khar": true, "Lydi": true, "Mand": true, "Mani": true, "Mend": true, "Nbat": true, "Nkoo": true,
+	"Narb": true, "Orkh": true, "Palm": true, "Phli": true, "Phlp": true, "Phnx": true, "Prti": true,
+	"Rohg": true, "Samr": true, "Sarb": true, "Sogd": true, "Sogo": true, "Syrc": true, "Thaa": true,
+	"Yezi": true,
+}
+
+func init() {
+	for _, line := range strings.Split(catalogTSV, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Split(line, "\t")
+		lang := Language{Code: f[0], ISO6393: f[1], Name: f[2], NativeName: f[3], Script: f[4], Direction: Direction(f[4])}
+		if len(lang.Code) == 2 {
+			lang.ISO6391 = lang.Code
+		}
+		byCode[lang.Code] = len(catalog)
+		byCode[lang.ISO6393] = len(catalog)
+		catalog = append(catalog, lang)
+	}
+}
+
+// Direction returns the writing direction of an ISO 15924 script, "ltr"
+// for unknown ones.
+func Direction(script string) string {
+	if rtlScripts[script] {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// All returns the catalog sorted by code.
+func All() []Language {
+	return append([]Language(nil), catalog...)
+}
+
+// Lookup finds the language for a code in any case: ISO 639-1, 639-2/B,
+// 639-3, a deprecated code such as "iw", or a BCP 47 tag such as "pt-BR"
+// or "sr-Latn". For tags the returned Code keeps the region and script in
+// canonical form, and an explicit script overrides the usual one.
+func Lookup(code string) (Language, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i, ok := byCode[code]; ok {
+		return catalog[i], true
+	}
+
+	tag, err := language.Parse(code)
+	if err != nil {
+		return Language{}, false
+	}
+	base, _ := tag.Base()
+	i, ok := byCode[base.String()]
+	if !ok {
+		return Language{}, false
+	}
+	lang := catalog[i]
+
+	script, confidence := tag.Script()
+	region, regionConfidence := tag.Region()
+	code = lang.Code
+	if confidence == language.Exact {
+		lang.Script = script.String()
+		lang.Direction = Direction(lang.Script)
+		code += "-" + lang.Script
+	}
+	if regionConfidence == language.Exact {
+		code += "-" + region.String()
+	}
+	lang.Code = code
+	return lang, true
+}
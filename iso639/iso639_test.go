@@ -0,0 +1,44 @@
+package iso639
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		code, want, script, direction string
+	}{
+		{"en", "en", "Latn", "ltr"},
+		{"eng", "en", "Latn", "ltr"},
+		{"iw", "he", "Hebr", "rtl"},
+		{"grc", "grc", "Grek", "ltr"},
+		{"sga", "sga", "Latn", "ltr"},
+		{"ar", "ar", "Arab", "rtl"},
+		{" PT-br ", "pt-BR", "Latn", "ltr"},
+		{"sr-Latn", "sr-Latn", "Latn", "ltr"},
+		{"pi", "pi", "", "ltr"},
+	}
+	for _, tt := range tests {
+		lang, ok := Lookup(tt.code)
+		if !ok {
+			t.Errorf("Lookup(%q) not found", tt.code)
+			continue
+		}
+		if lang.Code != tt.want || lang.Script != tt.script || lang.Direction != tt.direction {
+			t.Errorf("Lookup(%q) = %s %s %s, want %s %s %s", tt.code,
+				lang.Code, lang.Script, lang.Direction, tt.want, tt.script, tt.direction)
+		}
+	}
+
+	for _, code := range []string{"tok", "xx", ""} {
+		if _, ok := Lookup(code); ok {
+			t.Errorf("Lookup(%q) found, want not found", code)
+		}
+	}
+}
+
+func TestCatalogScripts(t *testing.T) {
+	for _, lang := range All() {
+		if lang.Script == "Zzzz" {
+			t.Errorf("%s has the unknown script Zzzz", lang.Code)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"language-learner/scheduler"
+	"time"
+)
 
 type User struct {
 	ID        int       `json:"id"`
@@ -13,6 +17,8 @@ type Language struct {
 	UserID       int       `json:"user_id"`
 	LanguageCode string    `json:"language_code"`
 	LanguageName string    `json:"language_name"`
+	Script       string    `json:"script,omitempty"`    // ISO 15924, e.g. Latn
+	Direction    string    `json:"direction,omitempty"` // ltr or rtl
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -27,6 +33,9 @@ type LearningItem struct {
 	Pronunciation  string    `json:"pronunciation,omitempty"`
 	ExampleUsage   string    `json:"example_usage,omitempty"`
 	Notes          string    `json:"notes,omitempty"`
+	AudioData      string    `json:"audio_data,omitempty"` // data URL accepted on create, never returned
+	HasAudio       bool      `json:"has_audio"`
+	Tags           []string  `json:"tags,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 }
 
@@ -35,8 +44,11 @@ type FlashcardSession struct {
 	UserID     int       `json:"user_id"`
 	LanguageID int       `json:"language_id"`
 	ItemID     int       `json:"item_id"`
-	ShownAt    time.Time `json:"shown_at"`
-	WasCorrect bool      `json:"was_correct"`
+	ShownAt    time.Time       `json:"shown_at"`
+	WasCorrect bool            `json:"was_correct"`
+	Grade      scheduler.Grade `json:"grade,omitempty"`      // again, hard, good, easy
+	ResponseMs *int            `json:"response_ms,omitempty"` // time taken to answer
+	Direction  string          `json:"direction,omitempty"`   // forward, reverse
 }
 
 type FlashcardItem struct {
@@ -44,5 +56,122 @@ type FlashcardItem struct {
 	LastReviewed *time.Time `json:"last_reviewed,omitempty"`
 	ReviewCount  int        `json:"review_count"`
 	CorrectCount int        `json:"correct_count"`
+	DueAt        *time.Time `json:"due_at,omitempty"`
+	IntervalDays float64    `json:"interval_days"`
+	Ease         float64    `json:"ease,omitempty"`
+	Stability    float64    `json:"stability,omitempty"`
 }
 
+
+type UserSettings struct {
+	UserID         int    `json:"user_id"`
+	Timezone       string `json:"timezone"`
+	NewCardsPerDay int    `json:"new_cards_per_day"`
+	ReviewsPerDay  int    `json:"reviews_per_day"`
+}
+
+type DueQueue struct {
+	Cards            []FlashcardItem `json:"cards"`
+	DueCount         int             `json:"due_count"`
+	NewRemaining     int             `json:"new_remaining"`
+	ReviewsRemaining int             `json:"reviews_remaining"`
+}
+
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+type ItemRevision struct {
+	ID        int                    `json:"id"`
+	ItemID    int                    `json:"item_id"`
+	Revision  int                    `json:"revision"`
+	AuthorID  int                    `json:"author_id"`
+	Action    string                 `json:"action"` // create, update, restore
+	Changes   map[string]FieldChange `json:"changes"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type ItemAudio struct {
+	ItemID     int       `json:"item_id"`
+	MimeType   string    `json:"mime_type"`
+	SizeBytes  int       `json:"size_bytes"`
+	DurationMs *int      `json:"duration_ms,omitempty"`
+	SHA256     string    `json:"sha256"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type SearchResult struct {
+	LearningItem
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+type Tag struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	ItemCount int       `json:"item_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Deck struct {
+	ID          int    `json:"id"`
+	UserID      int    `json:"user_id"`
+	LanguageID  int    `json:"language_id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Predicate is set on smart decks, whose items are the ones matching it
+	Predicate json.RawMessage `json:"predicate,omitempty"`
+	ItemCount int             `json:"item_count"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// DeckItem is a learning item at its position in a deck.
+type DeckItem struct {
+	LearningItem
+	Position int `json:"position"`
+}
+
+// ImportIssue is a problem with one row of an import file. Row numbers the
+// file's records from 1: lines for CSV and TSV, including the header, and
+// notes for Anki packages.
+type ImportIssue struct {
+	Row         int    `json:"row"`
+	Field       string `json:"field,omitempty"`
+	Message     string `json:"message"`
+	DuplicateID int    `json:"duplicate_id,omitempty"`
+}
+
+// ImportReport summarizes an import. In a dry run Imported counts the rows
+// that would have been inserted.
+type ImportReport struct {
+	DryRun   bool          `json:"dry_run"`
+	Rows     int           `json:"rows"`
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"`
+	ItemIDs  []int         `json:"item_ids,omitempty"`
+	Audio    int           `json:"audio,omitempty"`
+	Sessions int           `json:"sessions,omitempty"`
+	Errors   []ImportIssue `json:"errors"`
+	Warnings []ImportIssue `json:"warnings"`
+}
+
+// AccountImportReport counts what a backup import restored and skipped, by
+// kind: languages, items, sessions, audio, decks and settings. Skipped
+// languages are merged into existing ones.
+type AccountImportReport struct {
+	DryRun   bool           `json:"dry_run"`
+	Imported map[string]int `json:"imported"`
+	Skipped  map[string]int `json:"skipped"`
+	Warnings []string       `json:"warnings"`
+}
+
+// Snapshot is a copy of the SQLite database taken with the online backup
+// API.
+type Snapshot struct {
+	Path      string    `json:"path"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	Pruned    []string  `json:"pruned,omitempty"` // older snapshots removed by retention
+}
@@ -0,0 +1,35 @@
+package normalize
+
+import "strings"
+
+// Cyrillic folds case and width, drops stress accents and folds ё to е.
+// Other marks are kept because they distinguish letters such as й and и.
+type Cyrillic struct{}
+
+func (Cyrillic) Normalize(s string) string {
+	return fold(s, func(r rune) bool {
+		// combining grave and acute (stress), and diaeresis (ё, ї)
+		return r == '\u0300' || r == '\u0301' || r == '\u0308'
+	})
+}
+
+var cyrillicToLatin = strings.NewReplacer(
+	"а", "a", "б", "b", "в", "v", "г", "g", "ґ", "g", "д", "d", "ђ", "dj",
+	"е", "e", "є", "ye", "ж", "zh", "з", "z", "и", "i", "і", "i", "ї", "yi",
+	"й", "y", "ј", "j", "к", "k", "л", "l", "љ", "lj", "м", "m", "н", "n",
+	"њ", "nj", "о", "o", "п", "p", "р", "r", "с", "s", "т", "t", "ћ", "c",
+	"у", "u", "ў", "u", "ф", "f", "х", "kh", "ц", "ts", "ч", "ch", "џ", "dz",
+	"ш", "sh", "щ", "shch", "ъ", "", "ы", "y", "ь", "", "э", "e", "ю", "yu",
+	"я", "ya",
+)
+
+// Transliterate romanizes normalized Cyrillic text.
+func (Cyrillic) Transliterate(s string) string {
+	return cyrillicToLatin.Replace(s)
+}
+
+func init() {
+	Register(Cyrillic{},
+		"ru", "uk", "be", "bg", "sr", "mk", "kk", "ky", "mn", "tg",
+		"rus", "ukr", "bel", "bul", "srp", "mkd", "kaz", "kir", "mon", "tgk")
+}
@@ -0,0 +1,27 @@
+package normalize
+
+import "strings"
+
+// Greek folds case, width and all accents and breathings. Case folding
+// also maps final sigma to σ.
+type Greek struct{}
+
+func (Greek) Normalize(s string) string {
+	return fold(s, isMark)
+}
+
+var greekToLatin = strings.NewReplacer(
+	"α", "a", "β", "v", "γ", "g", "δ", "d", "ε", "e", "ζ", "z", "η", "i",
+	"θ", "th", "ι", "i", "κ", "k", "λ", "l", "μ", "m", "ν", "n", "ξ", "x",
+	"ο", "o", "π", "p", "ρ", "r", "σ", "s", "τ", "t", "υ", "y", "φ", "f",
+	"χ", "ch", "ψ", "ps", "ω", "o",
+)
+
+// Transliterate romanizes normalized Greek text.
+func (Greek) Transliterate(s string) string {
+	return greekToLatin.Replace(s)
+}
+
+func init() {
+	Register(Greek{}, "el", "ell", "gre", "grc")
+}
@@ -0,0 +1,106 @@
+package normalize
+
+import "strings"
+
+// Japanese folds width (half-width katakana, full-width Latin), case, and
+// katakana to hiragana so either kana spelling finds the other. Dakuten are
+// kept since they change the sound. Kanji are left as is; searching by
+// reading relies on the item's pronunciation field.
+type Japanese struct{}
+
+func (Japanese) Normalize(s string) string {
+	folded := fold(s, func(r rune) bool {
+		return isMark(r) && r != '\u3099' && r != '\u309a'
+	})
+	return strings.Map(func(r rune) rune {
+		if r >= 'ァ' && r <= 'ヶ' {
+			return r - ('ァ' - 'ぁ')
+		}
+		return r
+	}, folded)
+}
+
+// Transliterate romanizes the hiragana in normalized text using Hepburn
+// spelling. Long vowel marks are dropped, so ラーメン becomes "ramen".
+func (Japanese) Transliterate(s string) string {
+	var b strings.Builder
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+
+		// Small tsu doubles the following consonant
+		if r == 'っ' {
+			if i+1 < len(rs) {
+				if next := kanaSyllable(rs, i+1); next != "" && next[0] != 'n' && strings.IndexByte("aeiou", next[0]) < 0 {
+					if strings.HasPrefix(next, "ch") {
+						b.WriteByte('t')
+					} else {
+						b.WriteByte(next[0])
+					}
+				}
+			}
+			continue
+		}
+		if r == 'ー' {
+			continue
+		}
+
+		if syl := kanaSyllable(rs, i); syl != "" {
+			b.WriteString(syl)
+			if i+1 < len(rs) && isSmallYa(rs[i+1]) {
+				i++
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// kanaSyllable romanizes the kana at rs[i], combining it with a following
+// small ゃ/ゅ/ょ when present.
+func kanaSyllable(rs []rune, i int) string {
+	base, ok := hiraganaRomaji[rs[i]]
+	if !ok {
+		return ""
+	}
+	if i+1 < len(rs) && isSmallYa(rs[i+1]) && strings.HasSuffix(base, "i") && len(base) > 1 {
+		small := hiraganaRomaji[rs[i+1]]
+		stem := strings.TrimSuffix(base, "i")
+		// shi, chi and ji drop the y: sha, cha, ja
+		if stem == "sh" || stem == "ch" || stem == "j" {
+			return stem + small[1:]
+		}
+		return stem + small
+	}
+	return base
+}
+
+func isSmallYa(r rune) bool {
+	return r == 'ゃ' || r == 'ゅ' || r == 'ょ'
+}
+
+var hiraganaRomaji = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ゔ': "vu",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa",
+}
+
+func init() {
+	Register(Japanese{}, "ja", "jpn")
+}
@@ -0,0 +1,36 @@
+package normalize
+
+import "strings"
+
+// latinLetters maps letters that have no decomposition to their usual
+// ASCII spelling.
+var latinLetters = strings.NewReplacer(
+	"æ", "ae", "œ", "oe", "ø", "o", "đ", "d", "ð", "d",
+	"ł", "l", "þ", "th", "ı", "i", "ħ", "h",
+)
+
+// Latin folds case, width and all diacritics, so "Café" and "cafe" match.
+type Latin struct{}
+
+func (Latin) Normalize(s string) string {
+	return latinLetters.Replace(fold(s, isMark))
+}
+
+// Latin covers languages written in the Latin alphabet whose accents are
+// often left out. Vietnamese and Yoruba are left to Default, since their
+// tone marks tell words apart.
+func init() {
+	Register(Latin{},
+		"af", "az", "bs", "ca", "cs", "cy", "da", "de", "en", "eo", "es", "et",
+		"eu", "fi", "fo", "fr", "ga", "gd", "gl", "hr", "ht", "hu", "id", "is",
+		"it", "la", "lb", "lt", "lv", "mg", "ms", "mt", "nb", "nl", "nn", "no",
+		"oc", "pl", "pt", "rm", "ro", "sk", "sl", "so", "sq", "sv", "sw", "tl",
+		"tr", "uz", "wa", "zu",
+		"afr", "aze", "bos", "cat", "ces", "cze", "cym", "wel", "dan", "deu",
+		"ger", "eng", "epo", "spa", "est", "eus", "baq", "fin", "fao", "fra",
+		"fre", "gle", "gla", "glg", "hat", "hrv", "hun", "ind", "isl", "ice",
+		"ita", "lat", "ltz", "lit", "lav", "mlg", "msa", "may", "mlt", "nob",
+		"nld", "dut", "nno", "nor", "oci", "pol", "por", "roh", "ron", "rum",
+		"slk", "slo", "slv", "som", "sqi", "alb", "swe", "swa", "tgl", "fil",
+		"tur", "uzb", "wln", "zul")
+}
@@ -0,0 +1,145 @@
+// Package normalize folds text for search and duplicate detection. Each
+// language code maps to a Normalizer that removes differences learners do
+// not care about when looking things up: case, width and, for the scripts
+// registered here, accents and the choice between equivalent characters.
+package normalize
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer folds text into the form used for indexing and querying.
+type Normalizer interface {
+	Normalize(s string) string
+}
+
+// Transliterator is implemented by normalizers that can also spell
+// normalized text in Latin letters, so a romanized query finds native text.
+type Transliterator interface {
+	Transliterate(s string) string
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Normalizer{}
+)
+
+// Default is used for language codes without a registered normalizer.
+var Default Normalizer = Plain{}
+
+// Plain folds only case and width. Combining marks are kept: in scripts
+// such as Devanagari, Thai and Arabic they are vowels and consonants, not
+// accents, so removing them would make different words match.
+type Plain struct{}
+
+func (Plain) Normalize(s string) string {
+	return fold(s, nil)
+}
+
+// Register associates n with each of the given language codes.
+func Register(n Normalizer, codes ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, code := range codes {
+		registry[baseCode(code)] = n
+	}
+}
+
+// For returns the normalizer for a language code such as "ja" or "pt-BR".
+func For(languageCode string) Normalizer {
+	mu.RLock()
+	defer mu.RUnlock()
+	if n, ok := registry[baseCode(languageCode)]; ok {
+		return n
+	}
+	return Default
+}
+
+// Key returns the normalized form of s used to detect duplicates.
+func Key(languageCode, s string) string {
+	return strings.Join(strings.Fields(For(languageCode).Normalize(s)), " ")
+}
+
+// SearchText returns the text indexed for search: every non-empty field
+// normalized and, when the language supports it, transliterated.
+func SearchText(languageCode string, fields ...string) string {
+	n := For(languageCode)
+	t, _ := n.(Transliterator)
+
+	var parts []string
+	for _, field := range fields {
+		if field == "" {
+			continue
+		}
+		folded := n.Normalize(field)
+		parts = append(parts, folded)
+		if t != nil {
+			if latin := t.Transliterate(folded); latin != folded {
+				parts = append(parts, latin)
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Variants returns the distinct forms of a query under the given languages'
+// normalizers, including transliterations.
+func Variants(q string, languageCodes ...string) []string {
+	if len(languageCodes) == 0 {
+		languageCodes = []string{""}
+	}
+
+	seen := map[string]bool{}
+	var variants []string
+	add := func(v string) {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			variants = append(variants, v)
+		}
+	}
+	for _, code := range languageCodes {
+		n := For(code)
+		folded := n.Normalize(q)
+		add(folded)
+		if t, ok := n.(Transliterator); ok {
+			add(t.Transliterate(folded))
+		}
+	}
+	return variants
+}
+
+// baseCode reduces "pt-BR" or " ES " to the lowercase primary subtag.
+func baseCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	return code
+}
+
+// fold applies compatibility normalization (which folds full- and
+// half-width forms), full case folding, and removes the combining marks
+// selected by strip, if any.
+func fold(s string, strip func(rune) bool) string {
+	steps := []transform.Transformer{norm.NFKC, cases.Fold()}
+	if strip != nil {
+		steps = append(steps, norm.NFD, runes.Remove(runes.Predicate(strip)))
+	}
+	steps = append(steps, norm.NFC)
+	out, _, err := transform.String(transform.Chain(steps...), s)
+	if err != nil {
+		return strings.ToLower(s)
+	}
+	return out
+}
+
+func isMark(r rune) bool {
+	return unicode.Is(unicode.Mn, r)
+}
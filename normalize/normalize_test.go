@@ -0,0 +1,93 @@
+package normalize
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name, code, in, want string
+	}{
+		{"latin accents", "fr", "Café", "cafe"},
+		{"latin region subtag", "pt-BR", "AÇÃO", "acao"},
+		{"latin letters without decomposition", "da", "Ærø", "aero"},
+		{"cyrillic capital yo", "ru", "Ёлка", "елка"},
+		{"cyrillic small yo", "ru", "ёлка", "елка"},
+		{"cyrillic stress", "ru", "моло́ко", "молоко"},
+		{"cyrillic short i kept", "ru", "Йод", "йод"},
+		{"greek final sigma", "el", "ΟΔΟΣ", "οδοσ"},
+		{"greek tonos", "el", "οδός", "οδοσ"},
+		{"greek breathing and circumflex", "grc", "Ἀθῆναι", "αθηναι"},
+		{"katakana to hiragana", "ja", "カタカナ", "かたかな"},
+		{"half-width katakana", "ja", "ｶﾀｶﾅ", "かたかな"},
+		{"full-width latin", "ja", "ＡＢＣ", "abc"},
+		{"dakuten kept", "ja", "ガギグ", "がぎぐ"},
+		{"half-width handakuten kept", "ja", "ﾊﾟﾝ", "ぱん"},
+		{"devanagari vowel signs kept", "hi", "कुल", "कुल"},
+		{"thai tone marks kept", "th", "ที่", "ที่"},
+		{"arabic harakat kept", "ar", "كَتَبَ", "كَتَبَ"},
+		{"vietnamese tones kept", "vi", "Má", "má"},
+		{"fallback folds case and width", "hi", "ＡＢＣ", "abc"},
+		{"fallback without a code", "", "Straße", "strasse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := For(tt.code).Normalize(tt.in); got != tt.want {
+				t.Errorf("For(%q).Normalize(%q) = %q, want %q", tt.code, tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		code, a, b string
+		same       bool
+	}{
+		{"fr", "Café  au lait", "cafe au lait", true},
+		{"ja", "ラーメン", "らーめん", true},
+		{"ja", "か", "が", false},
+		{"ru", "Ёж", "еж", true},
+		{"hi", "कुल", "कल", false},
+		{"th", "ใกล้", "ไกล", false},
+		{"vi", "ma", "má", false},
+	}
+	for _, tt := range tests {
+		a, b := Key(tt.code, tt.a), Key(tt.code, tt.b)
+		if (a == b) != tt.same {
+			t.Errorf("Key(%q, %q) = %q, Key(%q, %q) = %q; same = %v, want %v",
+				tt.code, tt.a, a, tt.code, tt.b, b, a == b, tt.same)
+		}
+	}
+}
+
+func TestFor(t *testing.T) {
+	tests := []struct {
+		code string
+		want Normalizer
+	}{
+		{"en", Latin{}},
+		{" ES-mx ", Latin{}},
+		{"el", Greek{}},
+		{"uk", Cyrillic{}},
+		{"ja_JP", Japanese{}},
+		{"hi", Default},
+		{"tok", Default},
+		{"", Default},
+	}
+	for _, tt := range tests {
+		if got := For(tt.code); got != tt.want {
+			t.Errorf("For(%q) = %T, want %T", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestVariants(t *testing.T) {
+	// Russian folds ё and adds a romanization; the fallback keeps ё
+	got := Variants("Ёлка", "ru", "hi")
+	want := []string{"елка", "elka", "ёлка"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Variants = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+// Package router maps the Go API's URLs to handlers. The standalone server
+// (cmd/server) and the Vercel function (go-api) both serve New, so they
+// expose the same routes.
+package router
+
+import (
+	"language-learner/handlers"
+	"net/http"
+	"strings"
+)
+
+// Prefix is the path every route is served under. Incompatible changes to
+// the API get a new version.
+const Prefix = "/api/v1"
+
+// New returns the API handler. Requests for a known path with a method it
+// doesn't support get 405 with an Allow header, which http.ServeMux sends
+// for method patterns.
+func New() http.Handler {
+	mux := http.NewServeMux()
+
+	// handle registers a "METHOD /path" pattern under Prefix
+	handle := func(pattern string, h http.HandlerFunc) {
+		method, path, _ := strings.Cut(pattern, " ")
+		mux.HandleFunc(method+" "+Prefix+path, h)
+	}
+	// Everything outside /auth acts on a user's data and needs a token
+	protected := func(pattern string, h http.HandlerFunc) {
+		handle(pattern, handlers.RequireAuth(h))
+	}
+
+	handle("POST /auth/login", handlers.HandleLogin)
+	handle("POST /auth/signup", handlers.HandleSignup)
+	handle("POST /auth/verify", handlers.HandleVerify)
+	handle("POST /auth/forgot-password", handlers.HandleForgotPassword)
+	handle("POST /auth/reset-password", handlers.HandleResetPassword)
+
+	protected("DELETE /account", handlers.DeleteAccount)
+	protected("GET /account/export", handlers.ExportAccount)
+	protected("POST /account/import", handlers.ImportAccount)
+
+	protected("GET /languages", handlers.GetLanguages)
+	protected("POST /languages", handlers.CreateLanguage)
+	protected("GET /languages/catalog", handlers.GetLanguageCatalog)
+	protected("PATCH /languages/{id}", handlers.UpdateLanguage)
+	protected("PUT /languages/{id}", handlers.UpdateLanguage)
+	protected("DELETE /languages/{id}", handlers.DeleteLanguage)
+
+	protected("GET /items", handlers.GetLearningItems)
+	protected("POST /items", handlers.CreateLearningItem)
+	protected("GET /items/search", handlers.SearchLearningItems)
+	protected("GET /items/export", handlers.ExportLearningItems)
+	protected("POST /items/import", handlers.ImportLearningItems)
+	protected("POST /items/import/anki", handlers.ImportAnkiPackage)
+	protected("GET /items/{id}", handlers.GetLearningItem)
+	protected("PATCH /items/{id}", handlers.UpdateLearningItem)
+	protected("PUT /items/{id}", handlers.UpdateLearningItem)
+	protected("DELETE /items/{id}", handlers.DeleteLearningItem)
+	protected("GET /items/{id}/history", handlers.GetItemHistory)
+	protected("POST /items/{id}/restore", handlers.RestoreItemRevision)
+	protected("GET /items/{id}/audio", handlers.GetItemAudio)
+	protected("POST /items/{id}/audio", handlers.UploadItemAudio)
+	protected("DELETE /items/{id}/audio", handlers.DeleteItemAudio)
+
+	protected("GET /flashcards", handlers.GetFlashcards)
+	protected("POST /flashcards", handlers.RecordFlashcardSession)
+	protected("GET /flashcards/due", handlers.GetDueFlashcards)
+
+	protected("GET /tags", handlers.GetTags)
+	protected("POST /tags", handlers.CreateTag)
+	protected("PATCH /tags/{id}", handlers.UpdateTag)
+	protected("PUT /tags/{id}", handlers.UpdateTag)
+	protected("DELETE /tags/{id}", handlers.DeleteTag)
+
+	protected("GET /decks", handlers.GetDecks)
+	protected("POST /decks", handlers.CreateDeck)
+	protected("PATCH /decks/{id}", handlers.UpdateDeck)
+	protected("PUT /decks/{id}", handlers.UpdateDeck)
+	protected("DELETE /decks/{id}", handlers.DeleteDeck)
+	protected("GET /decks/{id}/items", handlers.GetDeckItems)
+	protected("POST /decks/{id}/items", handlers.AddDeckItems)
+	protected("PUT /decks/{id}/items", handlers.ReorderDeckItems)
+	protected("DELETE /decks/{id}/items/{itemID}", handlers.RemoveDeckItem)
+
+	protected("GET /settings", handlers.GetSettings)
+	protected("PUT /settings", handlers.UpdateSettings)
+
+	protected("POST /admin/backup", handlers.RequireAdmin(handlers.HandleBackup))
+
+	return withCORS(mux)
+}
+
+// withCORS lets the Next.js frontend call the API from another origin and
+// answers preflight requests itself.
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
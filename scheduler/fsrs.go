@@ -0,0 +1,92 @@
+package scheduler
+
+import "math"
+
+const (
+	fsrsDecay  = -0.5
+	fsrsFactor = 19.0 / 81.0
+)
+
+// fsrsDefaultWeights are the published FSRS-4.5 default parameters.
+var fsrsDefaultWeights = [17]float64{
+	0.4872, 1.4003, 3.7145, 13.8206, 5.1618, 1.2298, 0.8975, 0.031,
+	1.6474, 0.1367, 1.0461, 2.1072, 0.0793, 0.3246, 1.587, 0.2272, 2.8755,
+}
+
+// FSRS implements the Free Spaced Repetition Scheduler (v4.5) without
+// short-term learning steps; every interval is at least one day.
+type FSRS struct {
+	Weights          [17]float64
+	DesiredRetention float64
+	MaximumInterval  float64
+}
+
+// NewFSRS returns an FSRS scheduler with the default parameters.
+func NewFSRS() FSRS {
+	return FSRS{
+		Weights:          fsrsDefaultWeights,
+		DesiredRetention: 0.9,
+		MaximumInterval:  36500,
+	}
+}
+
+func (FSRS) Name() string { return "fsrs" }
+
+func (f FSRS) Next(state CardState, review Review) CardState {
+	w := f.Weights
+	// Grades outside 1-4 in stored history count as the nearest valid one
+	grade := Grade(clamp(float64(review.Grade), float64(Again), float64(Easy)))
+	g := float64(grade)
+
+	if state.Stability == 0 {
+		state.Stability = w[grade-1]
+		state.Difficulty = f.initialDifficulty(g)
+	} else {
+		elapsed := math.Max(review.At.Sub(state.LastReview).Hours()/24, 0)
+		r := retrievability(elapsed, state.Stability)
+
+		if grade == Again {
+			state.Stability = w[11] * math.Pow(state.Difficulty, -w[12]) *
+				(math.Pow(state.Stability+1, w[13]) - 1) * math.Exp(w[14]*(1-r))
+			state.Lapses++
+		} else {
+			bonus := 1.0
+			if grade == Hard {
+				bonus = w[15]
+			} else if grade == Easy {
+				bonus = w[16]
+			}
+			state.Stability *= 1 + math.Exp(w[8])*(11-state.Difficulty)*
+				math.Pow(state.Stability, -w[9])*(math.Exp(w[10]*(1-r))-1)*bonus
+		}
+
+		// Move difficulty by the grade, then revert it toward the default
+		d := state.Difficulty - w[6]*(g-3)
+		state.Difficulty = clamp(w[7]*f.initialDifficulty(3)+(1-w[7])*d, 1, 10)
+	}
+
+	state.Reps++
+	state.IntervalDays = f.interval(state.Stability)
+	state.LastReview = review.At
+	state.Due = addDays(review.At, state.IntervalDays)
+	return state
+}
+
+func (f FSRS) initialDifficulty(g float64) float64 {
+	return clamp(f.Weights[4]-(g-3)*f.Weights[5], 1, 10)
+}
+
+// interval is the number of days until recall probability drops to the
+// desired retention.
+func (f FSRS) interval(stability float64) float64 {
+	days := stability / fsrsFactor * (math.Pow(f.DesiredRetention, 1/fsrsDecay) - 1)
+	return clamp(math.Round(days), 1, f.MaximumInterval)
+}
+
+func retrievability(elapsedDays, stability float64) float64 {
+	return math.Pow(1+fsrsFactor*elapsedDays/stability, fsrsDecay)
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Min(math.Max(v, lo), hi)
+}
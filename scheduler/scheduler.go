@@ -0,0 +1,108 @@
+// Package scheduler computes spaced-repetition card state from review history.
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Grade is how well the learner recalled a card.
+type Grade int
+
+const (
+	Again Grade = iota + 1
+	Hard
+	Good
+	Easy
+)
+
+var gradeNames = map[Grade]string{Again: "again", Hard: "hard", Good: "good", Easy: "easy"}
+
+func (g Grade) Valid() bool { return g >= Again && g <= Easy }
+
+// Correct reports whether the grade counts as a successful recall.
+func (g Grade) Correct() bool { return g >= Hard }
+
+func (g Grade) String() string {
+	if name, ok := gradeNames[g]; ok {
+		return name
+	}
+	return fmt.Sprintf("Grade(%d)", int(g))
+}
+
+// UnmarshalJSON accepts either the numeric grade (1-4) or its name.
+func (g *Grade) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return json.Unmarshal(data, (*int)(g))
+	}
+	for grade, n := range gradeNames {
+		if strings.EqualFold(name, n) {
+			*g = grade
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown grade %q", name)
+}
+
+// Review is a single answer recorded in flashcard_sessions.
+type Review struct {
+	At    time.Time
+	Grade Grade
+}
+
+// CardState is the scheduling state of one learning item.
+// Ease is only meaningful for SM-2 and Difficulty only for FSRS.
+type CardState struct {
+	Ease         float64
+	IntervalDays float64
+	Stability    float64
+	Difficulty   float64
+	Reps         int
+	Lapses       int
+	LastReview   time.Time
+	Due          time.Time
+}
+
+// Scheduler turns a card's current state and a new review into its next state.
+type Scheduler interface {
+	Name() string
+	Next(state CardState, review Review) CardState
+}
+
+// Default is the algorithm used when none is configured.
+const Default = "sm2"
+
+// New returns the scheduler registered under name.
+func New(name string) (Scheduler, error) {
+	switch name {
+	case "", "sm2":
+		return SM2{}, nil
+	case "fsrs":
+		return NewFSRS(), nil
+	}
+	return nil, fmt.Errorf("unknown scheduler %q", name)
+}
+
+// Replay applies reviews in order to a new card and returns the final state.
+func Replay(s Scheduler, reviews []Review) CardState {
+	var state CardState
+	for _, review := range reviews {
+		state = s.Next(state, review)
+	}
+	return state
+}
+
+// GradeFromCorrect maps the pass/fail answers used by older clients.
+func GradeFromCorrect(correct bool) Grade {
+	if correct {
+		return Good
+	}
+	return Again
+}
+
+func addDays(t time.Time, days float64) time.Time {
+	return t.Add(time.Duration(days * float64(24*time.Hour)))
+}
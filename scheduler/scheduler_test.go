@@ -0,0 +1,196 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// step is the state expected after one review, taken on the day the previous
+// review made the card due.
+type step struct {
+	grade      Grade
+	interval   float64
+	ease       float64 // SM-2 only
+	stability  float64 // FSRS only
+	difficulty float64 // FSRS only
+	reps       int
+	lapses     int
+}
+
+func runSteps(t *testing.T, s Scheduler, steps []step) {
+	t.Helper()
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	var state CardState
+	for i, st := range steps {
+		state = s.Next(state, Review{At: at, Grade: st.grade})
+		if state.IntervalDays != st.interval || state.Reps != st.reps || state.Lapses != st.lapses {
+			t.Errorf("review %d (%v): interval %v reps %d lapses %d, want %v %d %d",
+				i+1, st.grade, state.IntervalDays, state.Reps, state.Lapses, st.interval, st.reps, st.lapses)
+		}
+		if st.ease != 0 && !near(state.Ease, st.ease) {
+			t.Errorf("review %d (%v): ease %.4f, want %.4f", i+1, st.grade, state.Ease, st.ease)
+		}
+		if st.stability != 0 && (!near(state.Stability, st.stability) || !near(state.Difficulty, st.difficulty)) {
+			t.Errorf("review %d (%v): stability %.4f difficulty %.4f, want %.4f %.4f",
+				i+1, st.grade, state.Stability, state.Difficulty, st.stability, st.difficulty)
+		}
+		if !state.LastReview.Equal(at) || !state.Due.Equal(addDays(at, state.IntervalDays)) {
+			t.Errorf("review %d (%v): last review %v due %v", i+1, st.grade, state.LastReview, state.Due)
+		}
+		at = state.Due
+	}
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 5e-5 }
+
+func TestSM2(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"good", []step{
+			{grade: Good, interval: 1, ease: 2.5, reps: 1},
+			{grade: Good, interval: 6, ease: 2.5, reps: 2},
+			{grade: Good, interval: 15, ease: 2.5, reps: 3},
+			{grade: Good, interval: 38, ease: 2.5, reps: 4},
+		}},
+		{"easy and hard", []step{
+			{grade: Easy, interval: 1, ease: 2.6, reps: 1},
+			{grade: Easy, interval: 6, ease: 2.7, reps: 2},
+			{grade: Hard, interval: 15, ease: 2.56, reps: 3},
+		}},
+		{"lapse", []step{
+			{grade: Good, interval: 1, ease: 2.5, reps: 1},
+			{grade: Good, interval: 6, ease: 2.5, reps: 2},
+			{grade: Again, interval: 1, ease: 1.96, reps: 0, lapses: 1},
+			{grade: Good, interval: 1, ease: 1.96, reps: 1, lapses: 1},
+			{grade: Good, interval: 6, ease: 1.96, reps: 2, lapses: 1},
+			{grade: Good, interval: 12, ease: 1.96, reps: 3, lapses: 1},
+		}},
+		// Failing a new card is not a lapse, and ease stops at its minimum
+		{"again", []step{
+			{grade: Again, interval: 1, ease: 1.96},
+			{grade: Again, interval: 1, ease: 1.42},
+			{grade: Again, interval: 1, ease: 1.3},
+			{grade: Again, interval: 1, ease: 1.3},
+		}},
+		{"out of range grades", []step{
+			{grade: 0, interval: 1, ease: 1.96},
+			{grade: 9, interval: 1, ease: 2.06, reps: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { runSteps(t, SM2{}, tt.steps) })
+	}
+}
+
+func TestFSRS(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		// With 90% desired retention the interval is the stability in days
+		{"again", []step{{grade: Again, interval: 1, stability: 0.4872, difficulty: 7.6214, reps: 1}}},
+		{"hard", []step{{grade: Hard, interval: 1, stability: 1.4003, difficulty: 6.3916, reps: 1}}},
+		{"good", []step{{grade: Good, interval: 4, stability: 3.7145, difficulty: 5.1618, reps: 1}}},
+		{"easy", []step{{grade: Easy, interval: 14, stability: 13.8206, difficulty: 3.932, reps: 1}}},
+		{"lapse", []step{
+			{grade: Good, interval: 4, stability: 3.7145, difficulty: 5.1618, reps: 1},
+			{grade: Good, interval: 15, stability: 14.8081, difficulty: 5.1618, reps: 2},
+			{grade: Again, interval: 3, stability: 3.1493, difficulty: 6.9012, reps: 3, lapses: 1},
+			{grade: Good, interval: 9, stability: 9.1982, difficulty: 6.8472, reps: 4, lapses: 1},
+		}},
+		{"out of range grades", []step{
+			{grade: 0, interval: 1, stability: 0.4872, difficulty: 7.6214, reps: 1},
+			{grade: -3, interval: 1, reps: 2, lapses: 1},
+		}},
+		{"out of range high grade", []step{{grade: 7, interval: 14, stability: 13.8206, difficulty: 3.932, reps: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { runSteps(t, NewFSRS(), tt.steps) })
+	}
+}
+
+func TestFSRSMaximumInterval(t *testing.T) {
+	f := NewFSRS()
+	f.MaximumInterval = 10
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	state := f.Next(CardState{}, Review{At: at, Grade: Easy})
+	if state.IntervalDays != 10 {
+		t.Errorf("interval = %v, want the maximum of 10", state.IntervalDays)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	reviews := []Review{
+		{At: at, Grade: Good},
+		{At: at.AddDate(0, 0, 2), Grade: Hard},
+		{At: at.AddDate(0, 0, 9), Grade: Again},
+		{At: at.AddDate(0, 0, 10), Grade: Easy},
+	}
+	for _, s := range []Scheduler{SM2{}, NewFSRS()} {
+		var want CardState
+		for _, review := range reviews {
+			want = s.Next(want, review)
+		}
+		if got := Replay(s, reviews); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Replay = %+v, want %+v", s.Name(), got, want)
+		}
+		if got := Replay(s, nil); !reflect.DeepEqual(got, CardState{}) {
+			t.Errorf("%s: Replay(nil) = %+v, want a new card", s.Name(), got)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for name, want := range map[string]string{"": "sm2", "sm2": "sm2", "fsrs": "fsrs"} {
+		s, err := New(name)
+		if err != nil || s.Name() != want {
+			t.Errorf("New(%q) = %v, %v, want %s", name, s, err, want)
+		}
+	}
+	if _, err := New("leitner"); err == nil {
+		t.Error("New(leitner) succeeded")
+	}
+}
+
+func TestGradeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    Grade
+		wantErr bool
+	}{
+		{`1`, Again, false},
+		{`4`, Easy, false},
+		{`"again"`, Again, false},
+		{`"Hard"`, Hard, false},
+		{`"GOOD"`, Good, false},
+		{`"easy"`, Easy, false},
+		{`"perfect"`, 0, true},
+		{`"3"`, 0, true},
+		{`true`, 0, true},
+		{`2.5`, 0, true},
+	}
+	for _, tt := range tests {
+		var g Grade
+		err := json.Unmarshal([]byte(tt.json), &g)
+		if (err != nil) != tt.wantErr || g != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, %v, want %v (error %t)", tt.json, g, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGradeValid(t *testing.T) {
+	for g := Grade(-1); g <= 6; g++ {
+		if want := g >= 1 && g <= 4; g.Valid() != want {
+			t.Errorf("%v.Valid() = %t, want %t", g, g.Valid(), want)
+		}
+	}
+	if Again.Correct() || !Hard.Correct() || GradeFromCorrect(true) != Good || GradeFromCorrect(false) != Again {
+		t.Error("Again must be the only incorrect grade")
+	}
+}
@@ -0,0 +1,59 @@
+package scheduler
+
+import "math"
+
+const (
+	sm2InitialEase = 2.5
+	sm2MinimumEase = 1.3
+)
+
+// SM2 implements the SuperMemo-2 algorithm.
+type SM2 struct{}
+
+func (SM2) Name() string { return "sm2" }
+
+func (SM2) Next(state CardState, review Review) CardState {
+	if state.Reps == 0 && state.Ease == 0 {
+		state.Ease = sm2InitialEase
+	}
+
+	// SM-2 rates answers on a 0-5 scale; below 3 is a failed recall
+	q := sm2Quality(review.Grade)
+	state.Ease += 0.1 - float64(5-q)*(0.08+float64(5-q)*0.02)
+	state.Ease = math.Max(state.Ease, sm2MinimumEase)
+
+	if q < 3 {
+		if state.Reps > 0 {
+			state.Lapses++
+		}
+		state.Reps = 0
+		state.IntervalDays = 1
+	} else {
+		switch state.Reps {
+		case 0:
+			state.IntervalDays = 1
+		case 1:
+			state.IntervalDays = 6
+		default:
+			state.IntervalDays = math.Round(state.IntervalDays * state.Ease)
+		}
+		state.Reps++
+	}
+
+	state.Stability = state.IntervalDays
+	state.LastReview = review.At
+	state.Due = addDays(review.At, state.IntervalDays)
+	return state
+}
+
+func sm2Quality(g Grade) int {
+	switch {
+	case g <= Again:
+		return 1
+	case g == Hard:
+		return 3
+	case g >= Easy:
+		return 5
+	}
+	return 4
+}
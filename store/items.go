@@ -0,0 +1,210 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"language-learner/models"
+	"language-learner/normalize"
+	"strings"
+	"time"
+)
+
+// ItemHasAudio is a SELECT expression reporting whether the item aliased li
+// has a recording in item_audio or a data URL left in
+// learning_items.audio_data by the TypeScript backend.
+const ItemHasAudio = `(EXISTS (SELECT 1 FROM item_audio a WHERE a.item_id = li.id) OR COALESCE(li.audio_data, '') != '')`
+
+// ItemDependentTables hold rows keyed by item_id that are removed together
+// with their learning item. Every cascade over items goes through this list,
+// so a table added here is cleaned up everywhere.
+var ItemDependentTables = []string{"card_states", "flashcard_sessions", "item_revisions", "item_audio", "item_tags", "deck_items"}
+
+func (s *sqlStore) itemQuery() string {
+	return `SELECT li.id, li.user_id, li.language_id, li.type, li.content, li.translation, li.meaning,
+		li.pronunciation, li.example_usage, li.notes, li.created_at, ` + ItemHasAudio + `, ` + s.dialect.tagsJSON + `
+		FROM learning_items li`
+}
+
+func scanItem(row interface{ Scan(...interface{}) error }) (models.LearningItem, error) {
+	var item models.LearningItem
+	var translation, meaning, pronunciation, exampleUsage, notes sql.NullString
+	var tags string
+	err := row.Scan(&item.ID, &item.UserID, &item.LanguageID, &item.Type, &item.Content,
+		&translation, &meaning, &pronunciation, &exampleUsage, &notes, &item.CreatedAt, &item.HasAudio, &tags)
+	if err != nil {
+		return item, notFound(err)
+	}
+	item.Translation = translation.String
+	item.Meaning = meaning.String
+	item.Pronunciation = pronunciation.String
+	item.ExampleUsage = exampleUsage.String
+	item.Notes = notes.String
+	json.Unmarshal([]byte(tags), &item.Tags)
+	return item, nil
+}
+
+func (s *sqlStore) CreateItem(item *models.LearningItem) error {
+	return s.inTx(func(s *sqlStore) error {
+		lang, err := s.GetLanguage(item.LanguageID)
+		if err != nil {
+			return err
+		}
+		code := lang.LanguageCode
+
+		id, err := s.insert(
+			`INSERT INTO learning_items
+			(user_id, language_id, type, content, translation, meaning, pronunciation, example_usage, notes,
+				content_key, search_text)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			item.UserID, item.LanguageID, item.Type, item.Content,
+			item.Translation, item.Meaning, item.Pronunciation, item.ExampleUsage, item.Notes,
+			normalize.Key(code, item.Content),
+			normalize.SearchText(code, item.Content, item.Translation, item.Meaning,
+				item.Pronunciation, item.Notes, item.ExampleUsage),
+		)
+		if err != nil {
+			return err
+		}
+		item.ID = id
+		item.CreatedAt = time.Now().UTC()
+		return s.SetItemTags(item.UserID, item.ID, item.Tags)
+	})
+}
+
+func (s *sqlStore) SetItemTags(userID, itemID int, names []string) error {
+	return s.inTx(func(s *sqlStore) error {
+		if _, err := s.exec("DELETE FROM item_tags WHERE item_id = ?", itemID); err != nil {
+			return err
+		}
+		for _, name := range names {
+			var tagID int
+			err := s.queryRow("SELECT id FROM tags WHERE user_id = ? AND LOWER(name) = LOWER(?)", userID, name).Scan(&tagID)
+			if err == sql.ErrNoRows {
+				tagID, err = s.insert("INSERT INTO tags (user_id, name) VALUES (?, ?)", userID, name)
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := s.exec("INSERT INTO item_tags (item_id, tag_id) VALUES (?, ?) ON CONFLICT DO NOTHING", itemID, tagID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlStore) GetItem(id int) (models.LearningItem, error) {
+	return scanItem(s.queryRow(s.itemQuery()+" WHERE li.id = ?", id))
+}
+
+func (s *sqlStore) ListItems(filter ItemFilter) ([]models.LearningItem, error) {
+	query := s.itemQuery() + " WHERE li.user_id = ?"
+	args := []interface{}{filter.UserID}
+	if filter.LanguageID != 0 {
+		query += " AND li.language_id = ?"
+		args = append(args, filter.LanguageID)
+	}
+	if !filter.Created.From.IsZero() {
+		query += " AND li.created_at >= ?"
+		args = append(args, dbTime(filter.Created.From))
+	}
+	if !filter.Created.To.IsZero() {
+		query += " AND li.created_at < ?"
+		args = append(args, dbTime(filter.Created.To))
+	}
+	if len(filter.Tags) > 0 {
+		query += ` AND li.id IN (SELECT it.item_id FROM item_tags it JOIN tags t ON t.id = it.tag_id
+			WHERE t.user_id = ? AND LOWER(t.name) IN (` + strings.TrimSuffix(strings.Repeat("LOWER(?), ", len(filter.Tags)), ", ") + `)
+			GROUP BY it.item_id`
+		args = append(args, filter.UserID)
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+		}
+		if !filter.AnyTag {
+			query += " HAVING COUNT(DISTINCT t.id) = ?"
+			args = append(args, len(filter.Tags))
+		}
+		query += ")"
+	}
+	query += " ORDER BY li.created_at DESC, li.id DESC"
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.LearningItem
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqlStore) FindItemByKey(userID, languageID int, key string) (int, error) {
+	var id int
+	err := s.queryRow(
+		"SELECT id FROM learning_items WHERE user_id = ? AND language_id = ? AND content_key = ? ORDER BY id LIMIT 1",
+		userID, languageID, key,
+	).Scan(&id)
+	return id, notFound(err)
+}
+
+func (s *sqlStore) DeleteItem(id int) error {
+	return s.inTx(func(s *sqlStore) error {
+		for _, table := range ItemDependentTables {
+			if _, err := s.exec("DELETE FROM "+table+" WHERE item_id = ?", id); err != nil {
+				return err
+			}
+		}
+		result, err := s.exec("DELETE FROM learning_items WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *sqlStore) AddRevision(itemID, authorID int, action string, changes map[string]models.FieldChange) error {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	return s.inTx(func(s *sqlStore) error {
+		var revision int
+		if err := s.queryRow("SELECT COALESCE(MAX(revision), 0) + 1 FROM item_revisions WHERE item_id = ?", itemID).Scan(&revision); err != nil {
+			return err
+		}
+		_, err := s.exec(
+			"INSERT INTO item_revisions (item_id, revision, author_id, action, changes) VALUES (?, ?, ?, ?, ?)",
+			itemID, revision, authorID, action, string(data))
+		return err
+	})
+}
+
+func (s *sqlStore) SaveItemAudio(audio *models.ItemAudio, data []byte) error {
+	sum := sha256.Sum256(data)
+	audio.SHA256 = hex.EncodeToString(sum[:])
+	audio.SizeBytes = len(data)
+	audio.CreatedAt = time.Now()
+
+	_, err := s.exec(
+		`INSERT INTO item_audio (item_id, mime_type, size_bytes, duration_ms, sha256, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(item_id) DO UPDATE SET
+			mime_type = excluded.mime_type, size_bytes = excluded.size_bytes,
+			duration_ms = excluded.duration_ms, sha256 = excluded.sha256,
+			data = excluded.data, created_at = excluded.created_at`,
+		audio.ItemID, audio.MimeType, audio.SizeBytes, audio.DurationMs, audio.SHA256, data,
+		dbTime(audio.CreatedAt))
+	return err
+}
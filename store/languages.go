@@ -0,0 +1,67 @@
+package store
+
+import (
+	"language-learner/models"
+	"time"
+)
+
+// languageColumns are scanned by scanLanguage. Languages created before the
+// ISO 639 catalog have no script and are assumed to be left to right.
+const languageColumns = `id, user_id, language_code, language_name, COALESCE(script, ''),
+	COALESCE(direction, 'ltr'), created_at`
+
+func scanLanguage(row interface{ Scan(...interface{}) error }) (models.Language, error) {
+	var lang models.Language
+	err := row.Scan(&lang.ID, &lang.UserID, &lang.LanguageCode, &lang.LanguageName,
+		&lang.Script, &lang.Direction, &lang.CreatedAt)
+	return lang, notFound(err)
+}
+
+func (s *sqlStore) CreateLanguage(lang *models.Language) error {
+	if _, err := s.FindLanguage(lang.UserID, lang.LanguageCode); err != ErrNotFound {
+		if err == nil {
+			return ErrConflict
+		}
+		return err
+	}
+
+	id, err := s.insert(
+		"INSERT INTO languages (user_id, language_code, language_name, script, direction) VALUES (?, ?, ?, ?, ?)",
+		lang.UserID, lang.LanguageCode, lang.LanguageName, nullString(lang.Script), nullString(lang.Direction),
+	)
+	if err != nil {
+		return err
+	}
+	lang.ID = id
+	lang.CreatedAt = time.Now().UTC()
+	return nil
+}
+
+func (s *sqlStore) GetLanguage(id int) (models.Language, error) {
+	return scanLanguage(s.queryRow("SELECT "+languageColumns+" FROM languages WHERE id = ?", id))
+}
+
+func (s *sqlStore) FindLanguage(userID int, code string) (models.Language, error) {
+	return scanLanguage(s.queryRow(
+		"SELECT "+languageColumns+" FROM languages WHERE user_id = ? AND LOWER(language_code) = LOWER(?)",
+		userID, code,
+	))
+}
+
+func (s *sqlStore) ListLanguages(userID int) ([]models.Language, error) {
+	rows, err := s.query("SELECT "+languageColumns+" FROM languages WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var languages []models.Language
+	for rows.Next() {
+		lang, err := scanLanguage(rows)
+		if err != nil {
+			return nil, err
+		}
+		languages = append(languages, lang)
+	}
+	return languages, rows.Err()
+}
@@ -0,0 +1,14 @@
+package store
+
+import "database/sql"
+
+// NewPostgres returns a Store over a Postgres database opened with the
+// postgres driver and migrated to the current schema.
+func NewPostgres(db *sql.DB) Store {
+	return &sqlStore{db: db, dialect: dialect{
+		numberedParams: true,
+		tagsJSON:       postgresTagsJSON,
+	}}
+}
+
+const postgresTagsJSON = `(SELECT COALESCE(json_agg(t.name ORDER BY t.id), '[]')::text FROM item_tags it JOIN tags t ON t.id = it.tag_id WHERE it.item_id = li.id)`
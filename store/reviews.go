@@ -0,0 +1,81 @@
+package store
+
+import (
+	"database/sql"
+	"language-learner/models"
+	"language-learner/scheduler"
+	"time"
+)
+
+func (s *sqlStore) CreateSession(session *models.FlashcardSession) error {
+	if session.ShownAt.IsZero() {
+		session.ShownAt = time.Now().UTC()
+	}
+	wasCorrect := 0
+	if session.WasCorrect {
+		wasCorrect = 1
+	}
+	var grade interface{}
+	if session.Grade != 0 {
+		grade = int(session.Grade)
+	}
+
+	id, err := s.insert(
+		`INSERT INTO flashcard_sessions
+		(user_id, language_id, item_id, was_correct, grade, response_ms, direction, shown_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.UserID, session.LanguageID, session.ItemID, wasCorrect, grade,
+		session.ResponseMs, nullString(session.Direction), dbTime(session.ShownAt))
+	if err != nil {
+		return err
+	}
+	session.ID = id
+	return nil
+}
+
+func (s *sqlStore) ListSessions(userID, itemID int) ([]models.FlashcardSession, error) {
+	rows, err := s.query(
+		`SELECT id, user_id, language_id, item_id, shown_at, was_correct, grade, response_ms,
+			COALESCE(direction, '')
+		FROM flashcard_sessions WHERE user_id = ? AND item_id = ? ORDER BY shown_at, id`,
+		userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.FlashcardSession
+	for rows.Next() {
+		var session models.FlashcardSession
+		var grade, responseMs sql.NullInt64
+		err := rows.Scan(&session.ID, &session.UserID, &session.LanguageID, &session.ItemID,
+			&session.ShownAt, &session.WasCorrect, &grade, &responseMs, &session.Direction)
+		if err != nil {
+			return nil, err
+		}
+		session.Grade = scheduler.Grade(grade.Int64)
+		if responseMs.Valid {
+			ms := int(responseMs.Int64)
+			session.ResponseMs = &ms
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *sqlStore) SaveCardState(userID, itemID int, algorithm string, state scheduler.CardState) error {
+	_, err := s.exec(
+		`INSERT INTO card_states (item_id, user_id, algorithm, ease, interval_days, stability,
+			difficulty, reps, lapses, last_reviewed_at, due_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(item_id) DO UPDATE SET
+			algorithm = excluded.algorithm, ease = excluded.ease,
+			interval_days = excluded.interval_days, stability = excluded.stability,
+			difficulty = excluded.difficulty, reps = excluded.reps, lapses = excluded.lapses,
+			last_reviewed_at = excluded.last_reviewed_at, due_at = excluded.due_at,
+			updated_at = excluded.updated_at`,
+		itemID, userID, algorithm, state.Ease, state.IntervalDays, state.Stability,
+		state.Difficulty, state.Reps, state.Lapses,
+		dbTime(state.LastReview), dbTime(state.Due), dbTime(time.Now()))
+	return err
+}
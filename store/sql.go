@@ -0,0 +1,145 @@
+package store
+
+import (
+	"database/sql"
+	"language-learner/dates"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect holds what differs between the databases sqlStore runs on. Queries
+// are written with ? placeholders and rewritten for databases that number
+// them.
+type dialect struct {
+	numberedParams bool
+	// tagsJSON is a SELECT expression returning the names of the tags on
+	// the item aliased li as a JSON array.
+	tagsJSON string
+}
+
+// conn is satisfied by both *sql.DB and *sql.Tx.
+type conn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type sqlStore struct {
+	db      *sql.DB
+	tx      *sql.Tx // nil outside a transaction
+	dialect dialect
+}
+
+func (s *sqlStore) WithTx(tx *sql.Tx) Store {
+	return &sqlStore{db: s.db, tx: tx, dialect: s.dialect}
+}
+
+func (s *sqlStore) conn() conn {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+func (s *sqlStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.conn().Exec(s.rebind(query), args...)
+}
+
+func (s *sqlStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.conn().Query(s.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.conn().QueryRow(s.rebind(query), args...)
+}
+
+// insert runs an INSERT and returns the id of the new row. Both databases
+// support RETURNING, which Postgres needs since it has no LastInsertId.
+func (s *sqlStore) insert(query string, args ...interface{}) (int, error) {
+	var id int
+	err := s.queryRow(query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// inTx runs fn in the store's transaction, or in a new one committed when
+// fn succeeds.
+func (s *sqlStore) inTx(fn func(s *sqlStore) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&sqlStore{db: s.db, tx: tx, dialect: s.dialect}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numberedParams {
+		return query
+	}
+	return Rebind(query)
+}
+
+// Rebind rewrites the ? placeholders of query as $1, $2, ... for Postgres.
+// Question marks inside quoted strings are left alone.
+func Rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// TagsJSON returns the SELECT expression the stores use for the names of
+// the tags on the item aliased li as a JSON array, on Postgres or SQLite.
+func TagsJSON(postgres bool) string {
+	if postgres {
+		return postgresTagsJSON
+	}
+	return sqliteTagsJSON
+}
+
+// dbTime formats t for storage, see dates.Format; Postgres parses it into a
+// TIMESTAMP. The zero time is stored as NULL.
+func dbTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return dates.Format(t)
+}
+
+// nullString stores empty optional text columns as NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
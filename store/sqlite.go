@@ -0,0 +1,13 @@
+package store
+
+import "database/sql"
+
+// NewSQLite returns a Store over a SQLite database opened with the sqlite3
+// driver and migrated to the current schema.
+func NewSQLite(db *sql.DB) Store {
+	return &sqlStore{db: db, dialect: dialect{
+		tagsJSON: sqliteTagsJSON,
+	}}
+}
+
+const sqliteTagsJSON = `(SELECT json_group_array(t.name) FROM item_tags it JOIN tags t ON t.id = it.tag_id WHERE it.item_id = li.id)`
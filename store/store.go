@@ -0,0 +1,107 @@
+// Package store defines how the server persists users, languages, learning
+// items and reviews, independent of the database behind it. NewSQLite and
+// NewPostgres implement it over database/sql.
+//
+// Features outside these stores (tags management, decks, audio playback,
+// revisions history, imports and backups) run SQL against database.DB
+// directly, written with ? placeholders and in SQL both databases accept.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"language-learner/dates"
+	"language-learner/models"
+	"language-learner/scheduler"
+)
+
+var (
+	// ErrNotFound is returned when the requested row doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a row would duplicate a unique one.
+	ErrConflict = errors.New("already exists")
+)
+
+// Store is every store over one database. WithTx returns a Store whose
+// operations run in tx, so callers can combine them with their own SQL and
+// commit or roll back as one; without it each operation that writes more
+// than one row runs in its own transaction.
+type Store interface {
+	UserStore
+	LanguageStore
+	ItemStore
+	ReviewStore
+	WithTx(tx *sql.Tx) Store
+}
+
+// Account is a user with their credentials.
+type Account struct {
+	models.User
+	PasswordHash     string
+	ForgotQuestion   string
+	ForgotAnswerHash string
+}
+
+type UserStore interface {
+	// CreateUser inserts the account and sets its ID and CreatedAt. It
+	// returns ErrConflict if the username is taken.
+	CreateUser(account *Account) error
+	UserByID(id int) (Account, error)
+	UserByUsername(username string) (Account, error)
+	SetPasswordHash(userID int, hash string) error
+}
+
+type LanguageStore interface {
+	// CreateLanguage inserts lang and sets its ID and CreatedAt. It returns
+	// ErrConflict if the user already has the language code in any case.
+	CreateLanguage(lang *models.Language) error
+	GetLanguage(id int) (models.Language, error)
+	// FindLanguage looks up the user's language by code in any case.
+	FindLanguage(userID int, code string) (models.Language, error)
+	ListLanguages(userID int) ([]models.Language, error)
+}
+
+// ItemFilter selects a user's learning items. Zero fields don't filter.
+type ItemFilter struct {
+	UserID     int
+	LanguageID int
+	Created    dates.Range // when the item was logged
+	Tags       []string    // matched in any case
+	AnyTag     bool        // match items with any of Tags rather than all
+}
+
+type ItemStore interface {
+	// CreateItem inserts item with its tags, creating tags the user doesn't
+	// have yet, and sets its ID and CreatedAt. The language must exist, since
+	// the duplicate key and search text are normalized for it.
+	CreateItem(item *models.LearningItem) error
+	GetItem(id int) (models.LearningItem, error)
+	// SetItemTags replaces the item's tags with names, reusing the user's
+	// tags whose names match in any case and creating the rest.
+	SetItemTags(userID, itemID int, names []string) error
+	// ListItems returns the matching items, newest first.
+	ListItems(filter ItemFilter) ([]models.LearningItem, error)
+	// FindItemByKey returns the ID of the user's item in languageID whose
+	// normalized content key is key, or ErrNotFound.
+	FindItemByKey(userID, languageID int, key string) (int, error)
+	// DeleteItem removes the item with its tags, deck entries, audio,
+	// revisions, review sessions and card state.
+	DeleteItem(id int) error
+	// AddRevision appends the next revision to the item's history.
+	AddRevision(itemID, authorID int, action string, changes map[string]models.FieldChange) error
+	// SaveItemAudio stores data as the item's recording, replacing any
+	// previous one, and fills in the size, checksum and CreatedAt.
+	SaveItemAudio(audio *models.ItemAudio, data []byte) error
+}
+
+type ReviewStore interface {
+	// CreateSession inserts the session and sets its ID. A zero ShownAt is
+	// set to now.
+	CreateSession(session *models.FlashcardSession) error
+	// ListSessions returns the user's sessions of the item in the order they
+	// happened. Sessions recorded before grades existed have Grade 0.
+	ListSessions(userID, itemID int) ([]models.FlashcardSession, error)
+	// SaveCardState stores the item's scheduling state as computed by the
+	// named algorithm.
+	SaveCardState(userID, itemID int, algorithm string, state scheduler.CardState) error
+}
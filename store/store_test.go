@@ -0,0 +1,380 @@
+package store_test
+
+import (
+	"errors"
+	"language-learner/database"
+	"language-learner/dates"
+	"language-learner/models"
+	"language-learner/scheduler"
+	"language-learner/store"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The same tests run against every implementation. The Postgres run needs
+// TEST_POSTGRES_URL pointing at a disposable database: its public schema is
+// dropped before each test.
+func forEachStore(t *testing.T, test func(t *testing.T, s store.Store)) {
+	t.Run("sqlite", func(t *testing.T) {
+		t.Setenv("DATABASE_URL", "sqlite:"+filepath.Join(t.TempDir(), "test.db"))
+		test(t, openStore(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv("TEST_POSTGRES_URL")
+		if url == "" {
+			t.Skip("TEST_POSTGRES_URL not set")
+		}
+		t.Setenv("DATABASE_URL", url)
+		test(t, openStore(t))
+	})
+}
+
+func openStore(t *testing.T) store.Store {
+	t.Helper()
+	if err := database.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.CloseDB() })
+
+	if database.Postgres {
+		if _, err := database.DB.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := database.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	return database.Store
+}
+
+// exec runs SQL the store has no method for, such as backdating rows.
+func exec(t *testing.T, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := database.DB.Exec(query, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createUser(t *testing.T, s store.Store, username string) int {
+	t.Helper()
+	account := store.Account{PasswordHash: "hash", ForgotQuestion: "q", ForgotAnswerHash: "a"}
+	account.Username = username
+	if err := s.CreateUser(&account); err != nil {
+		t.Fatal(err)
+	}
+	return account.ID
+}
+
+func createLanguage(t *testing.T, s store.Store, userID int, code string) int {
+	t.Helper()
+	lang := models.Language{UserID: userID, LanguageCode: code, LanguageName: code}
+	if err := s.CreateLanguage(&lang); err != nil {
+		t.Fatal(err)
+	}
+	return lang.ID
+}
+
+func createItem(t *testing.T, s store.Store, userID, languageID int, content string, tags ...string) int {
+	t.Helper()
+	item := models.LearningItem{UserID: userID, LanguageID: languageID, Type: "word", Content: content, Tags: tags}
+	if err := s.CreateItem(&item); err != nil {
+		t.Fatal(err)
+	}
+	return item.ID
+}
+
+func itemContents(items []models.LearningItem) []string {
+	contents := []string{}
+	for _, item := range items {
+		contents = append(contents, item.Content)
+	}
+	return contents
+}
+
+func TestUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		id := createUser(t, s, "ana")
+
+		dup := store.Account{PasswordHash: "other"}
+		dup.Username = "ana"
+		if err := s.CreateUser(&dup); err != store.ErrConflict {
+			t.Errorf("CreateUser with a taken username = %v, want ErrConflict", err)
+		}
+
+		account, err := s.UserByUsername("ana")
+		if err != nil || account.ID != id || account.PasswordHash != "hash" {
+			t.Errorf("UserByUsername = %+v, %v", account, err)
+		}
+		if err := s.SetPasswordHash(id, "new"); err != nil {
+			t.Fatal(err)
+		}
+		if account, _ := s.UserByID(id); account.PasswordHash != "new" {
+			t.Errorf("PasswordHash = %q after SetPasswordHash, want new", account.PasswordHash)
+		}
+
+		if _, err := s.UserByID(id + 1); err != store.ErrNotFound {
+			t.Errorf("UserByID of a missing user = %v, want ErrNotFound", err)
+		}
+		if err := s.SetPasswordHash(id+1, "x"); err != store.ErrNotFound {
+			t.Errorf("SetPasswordHash of a missing user = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestLanguages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		userID := createUser(t, s, "ana")
+		esID := createLanguage(t, s, userID, "es")
+		createLanguage(t, s, userID, "fr")
+
+		dup := models.Language{UserID: userID, LanguageCode: "ES", LanguageName: "Spanish"}
+		if err := s.CreateLanguage(&dup); err != store.ErrConflict {
+			t.Errorf("CreateLanguage with a code in another case = %v, want ErrConflict", err)
+		}
+		// Another user may have the same language
+		createLanguage(t, s, createUser(t, s, "ben"), "es")
+
+		lang, err := s.GetLanguage(esID)
+		if err != nil || lang.LanguageCode != "es" || lang.UserID != userID || lang.Direction != "ltr" {
+			t.Errorf("GetLanguage = %+v, %v", lang, err)
+		}
+		if lang, err := s.FindLanguage(userID, "ES"); err != nil || lang.ID != esID {
+			t.Errorf("FindLanguage(ES) = %+v, %v", lang, err)
+		}
+		if _, err := s.FindLanguage(userID, "de"); err != store.ErrNotFound {
+			t.Errorf("FindLanguage of a missing code = %v, want ErrNotFound", err)
+		}
+		if _, err := s.GetLanguage(esID + 100); err != store.ErrNotFound {
+			t.Errorf("GetLanguage of a missing language = %v, want ErrNotFound", err)
+		}
+
+		languages, err := s.ListLanguages(userID)
+		if err != nil || len(languages) != 2 || languages[0].LanguageCode != "es" || languages[1].LanguageCode != "fr" {
+			t.Errorf("ListLanguages = %+v, %v", languages, err)
+		}
+	})
+}
+
+func TestItems(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		userID := createUser(t, s, "ana")
+		languageID := createLanguage(t, s, userID, "es")
+
+		item := models.LearningItem{UserID: userID, LanguageID: languageID, Type: "word",
+			Content: "Café", Translation: "coffee", Tags: []string{"food", "drinks"}}
+		if err := s.CreateItem(&item); err != nil {
+			t.Fatal(err)
+		}
+		if item.ID == 0 || item.CreatedAt.IsZero() {
+			t.Errorf("CreateItem didn't set ID and CreatedAt: %+v", item)
+		}
+
+		got, err := s.GetItem(item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Content != "Café" || got.Translation != "coffee" || got.HasAudio ||
+			!reflect.DeepEqual(got.Tags, []string{"food", "drinks"}) {
+			t.Errorf("GetItem = %+v", got)
+		}
+
+		// Duplicates are found by the normalized key
+		if id, err := s.FindItemByKey(userID, languageID, "cafe"); err != nil || id != item.ID {
+			t.Errorf("FindItemByKey(cafe) = %d, %v, want %d", id, err, item.ID)
+		}
+		if _, err := s.FindItemByKey(userID, languageID, "te"); err != store.ErrNotFound {
+			t.Errorf("FindItemByKey of a missing key = %v, want ErrNotFound", err)
+		}
+
+		// Tags are reused in any case
+		other := createItem(t, s, userID, languageID, "té", "FOOD")
+		if got, _ := s.GetItem(other); !reflect.DeepEqual(got.Tags, []string{"food"}) {
+			t.Errorf("Tags = %v, want the existing food tag", got.Tags)
+		}
+		if err := s.SetItemTags(userID, item.ID, []string{"Drinks", "hot"}); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := s.GetItem(item.ID); !reflect.DeepEqual(got.Tags, []string{"drinks", "hot"}) {
+			t.Errorf("Tags after SetItemTags = %v, want [drinks hot]", got.Tags)
+		}
+
+		if _, err := s.GetItem(other + 100); err != store.ErrNotFound {
+			t.Errorf("GetItem of a missing item = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestListItems(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		userID := createUser(t, s, "ana")
+		es := createLanguage(t, s, userID, "es")
+		fr := createLanguage(t, s, userID, "fr")
+		old := createItem(t, s, userID, es, "hola", "greeting", "basic")
+		createItem(t, s, userID, es, "adiós", "greeting")
+		createItem(t, s, userID, fr, "merci", "basic")
+		ben := createUser(t, s, "ben")
+		createItem(t, s, ben, createLanguage(t, s, ben, "es"), "otro", "greeting")
+
+		lastWeek := time.Now().UTC().AddDate(0, 0, -7)
+		exec(t, "UPDATE learning_items SET created_at = ? WHERE id = ?", dates.Format(lastWeek), old)
+
+		yesterday := time.Now().UTC().AddDate(0, 0, -1)
+		tests := []struct {
+			name   string
+			filter store.ItemFilter
+			want   []string
+		}{
+			{"all", store.ItemFilter{}, []string{"merci", "adiós", "hola"}},
+			{"language", store.ItemFilter{LanguageID: es}, []string{"adiós", "hola"}},
+			{"from", store.ItemFilter{Created: dates.Range{From: yesterday}}, []string{"merci", "adiós"}},
+			{"to", store.ItemFilter{Created: dates.Range{To: yesterday}}, []string{"hola"}},
+			{"all tags", store.ItemFilter{Tags: []string{"Greeting", "basic"}}, []string{"hola"}},
+			{"any tag", store.ItemFilter{Tags: []string{"greeting", "basic"}, AnyTag: true}, []string{"merci", "adiós", "hola"}},
+			{"unknown tag", store.ItemFilter{Tags: []string{"verbs"}}, []string{}},
+		}
+		for _, tt := range tests {
+			tt.filter.UserID = userID
+			items, err := s.ListItems(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := itemContents(items); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: ListItems = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestDeleteItem(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		userID := createUser(t, s, "ana")
+		languageID := createLanguage(t, s, userID, "es")
+		id := createItem(t, s, userID, languageID, "hola", "greeting")
+		kept := createItem(t, s, userID, languageID, "adiós", "greeting")
+
+		if err := s.AddRevision(id, userID, "create", nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SaveItemAudio(&models.ItemAudio{ItemID: id, MimeType: "audio/mpeg"}, []byte("audio")); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := s.GetItem(id); !got.HasAudio {
+			t.Error("HasAudio = false after SaveItemAudio")
+		}
+		session := models.FlashcardSession{UserID: userID, LanguageID: languageID, ItemID: id, Grade: scheduler.Good}
+		if err := s.CreateSession(&session); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SaveCardState(userID, id, "sm2", scheduler.CardState{Ease: 2.5}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.DeleteItem(id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetItem(id); err != store.ErrNotFound {
+			t.Errorf("GetItem after DeleteItem = %v, want ErrNotFound", err)
+		}
+		if err := s.DeleteItem(id); err != store.ErrNotFound {
+			t.Errorf("DeleteItem of a deleted item = %v, want ErrNotFound", err)
+		}
+		if sessions, err := s.ListSessions(userID, id); err != nil || len(sessions) != 0 {
+			t.Errorf("ListSessions after DeleteItem = %d sessions, %v, want none", len(sessions), err)
+		}
+		if got, _ := s.GetItem(kept); !reflect.DeepEqual(got.Tags, []string{"greeting"}) {
+			t.Errorf("the other item's tags = %v after DeleteItem, want [greeting]", got.Tags)
+		}
+	})
+}
+
+func TestSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		userID := createUser(t, s, "ana")
+		languageID := createLanguage(t, s, userID, "es")
+		itemID := createItem(t, s, userID, languageID, "hola")
+
+		ms := 1500
+		shownAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		sessions := []models.FlashcardSession{
+			{UserID: userID, LanguageID: languageID, ItemID: itemID, Grade: scheduler.Good,
+				WasCorrect: true, ResponseMs: &ms, Direction: "forward", ShownAt: shownAt},
+			{UserID: userID, LanguageID: languageID, ItemID: itemID, Grade: scheduler.Again},
+		}
+		for i := range sessions {
+			if err := s.CreateSession(&sessions[i]); err != nil {
+				t.Fatal(err)
+			}
+			if sessions[i].ID == 0 {
+				t.Errorf("CreateSession didn't set the ID of session %d", i)
+			}
+		}
+		if sessions[1].ShownAt.IsZero() {
+			t.Error("CreateSession didn't default ShownAt to now")
+		}
+
+		got, err := s.ListSessions(userID, itemID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("ListSessions returned %d sessions, want 2", len(got))
+		}
+		first := got[0]
+		if !first.ShownAt.Equal(shownAt) || first.Grade != scheduler.Good || !first.WasCorrect ||
+			first.ResponseMs == nil || *first.ResponseMs != ms || first.Direction != "forward" {
+			t.Errorf("first session = %+v", first)
+		}
+		if got[1].Grade != scheduler.Again || got[1].WasCorrect || got[1].ResponseMs != nil {
+			t.Errorf("second session = %+v", got[1])
+		}
+
+		state := scheduler.CardState{Ease: 2.5, IntervalDays: 1, Reps: 1, LastReview: shownAt, Due: shownAt.AddDate(0, 0, 1)}
+		if err := s.SaveCardState(userID, itemID, "sm2", state); err != nil {
+			t.Fatal(err)
+		}
+		state.Reps = 2
+		if err := s.SaveCardState(userID, itemID, "sm2", state); err != nil {
+			t.Errorf("SaveCardState over an existing state = %v", err)
+		}
+	})
+}
+
+func TestWithTx(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store) {
+		userID := createUser(t, s, "ana")
+		languageID := createLanguage(t, s, userID, "es")
+
+		tx, err := database.DB.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := createItem(t, s.WithTx(tx), userID, languageID, "hola", "greeting")
+		if _, err := s.WithTx(tx).GetItem(id); err != nil {
+			t.Errorf("GetItem inside the transaction = %v", err)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.GetItem(id); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("GetItem after rollback = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct{ query, want string }{
+		{"SELECT 1", "SELECT 1"},
+		{"WHERE a = ? AND b IN (?, ?)", "WHERE a = $1 AND b IN ($2, $3)"},
+		{"WHERE a = '?' AND b = ?", "WHERE a = '?' AND b = $1"},
+		{`WHERE "weird?" = ?`, `WHERE "weird?" = $1`},
+	}
+	for _, tt := range tests {
+		if got := store.Rebind(tt.query); got != tt.want {
+			t.Errorf("Rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package store
+
+import "time"
+
+const accountColumns = `id, username, password_hash, forgot_question, forgot_answer_hash, created_at`
+
+func scanAccount(row interface{ Scan(...interface{}) error }) (Account, error) {
+	var a Account
+	err := row.Scan(&a.ID, &a.Username, &a.PasswordHash, &a.ForgotQuestion, &a.ForgotAnswerHash, &a.CreatedAt)
+	return a, notFound(err)
+}
+
+func (s *sqlStore) CreateUser(account *Account) error {
+	if _, err := s.UserByUsername(account.Username); err != ErrNotFound {
+		if err == nil {
+			return ErrConflict
+		}
+		return err
+	}
+
+	id, err := s.insert(
+		"INSERT INTO users (username, password_hash, forgot_question, forgot_answer_hash) VALUES (?, ?, ?, ?)",
+		account.Username, account.PasswordHash, account.ForgotQuestion, account.ForgotAnswerHash,
+	)
+	if err != nil {
+		return err
+	}
+	account.ID = id
+	account.CreatedAt = time.Now().UTC()
+	return nil
+}
+
+func (s *sqlStore) UserByID(id int) (Account, error) {
+	return scanAccount(s.queryRow("SELECT "+accountColumns+" FROM users WHERE id = ?", id))
+}
+
+func (s *sqlStore) UserByUsername(username string) (Account, error) {
+	return scanAccount(s.queryRow("SELECT "+accountColumns+" FROM users WHERE username = ?", username))
+}
+
+func (s *sqlStore) SetPasswordHash(userID int, hash string) error {
+	result, err := s.exec("UPDATE users SET password_hash = ? WHERE id = ?", hash, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}